@@ -0,0 +1,53 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package filevar
+
+import "encoding/json"
+
+// A Codec converts values to and from their on-disk representation.
+type Codec[T any] interface {
+	// Marshal encodes the value.
+	Marshal(value T) ([]byte, error)
+	// Unmarshal decodes a value that was previously encoded.
+	Unmarshal(data []byte) (T, error)
+}
+
+// JSON returns a Codec that uses the encoding/json package. The output
+// is indented to allow the file to be edited by an operator.
+func JSON[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+type jsonCodec[T any] struct{}
+
+var _ Codec[any] = jsonCodec[any]{}
+
+// Marshal implements [Codec].
+func (jsonCodec[T]) Marshal(value T) ([]byte, error) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Unmarshal implements [Codec].
+func (jsonCodec[T]) Unmarshal(data []byte) (T, error) {
+	var ret T
+	err := json.Unmarshal(data, &ret)
+	return ret, err
+}
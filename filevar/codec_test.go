@@ -0,0 +1,44 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package filevar
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSON(t *testing.T) {
+	r := require.New(t)
+
+	type settings struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	codec := JSON[settings]()
+
+	data, err := codec.Marshal(settings{"hello", 42})
+	r.NoError(err)
+	r.Equal("{\n  \"name\": \"hello\",\n  \"count\": 42\n}\n", string(data))
+
+	decoded, err := codec.Unmarshal(data)
+	r.NoError(err)
+	r.Equal(settings{"hello", 42}, decoded)
+
+	_, err = codec.Unmarshal([]byte("not json"))
+	r.Error(err)
+}
@@ -0,0 +1,301 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package filevar contains a variant of [notify.Var] whose value is
+// persisted to a local file.
+package filevar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/field-eng-powertools/notify"
+	"github.com/cockroachdb/field-eng-powertools/stopper"
+)
+
+// errNotModified is returned from loadLocked if the file has not been
+// modified since it was last read or written.
+var errNotModified = errors.New("not modified")
+
+// Config controls the behavior of a [Var].
+type Config[T any] struct {
+	// The Codec used to read and write the file. If nil, [JSON] will be
+	// used.
+	Codec Codec[T]
+	// The value of the Var if the file does not exist. The file will
+	// not be created until the value is first updated.
+	Default T
+	// The location of the file. Required.
+	Path string
+	// The permissions of a newly-written file. If zero, 0644 will be
+	// used.
+	Perm fs.FileMode
+	// If non-zero, the file will be polled for external changes at the
+	// given interval.
+	Watch time.Duration
+}
+
+// A Var holds a value that is loaded from and persisted to a file. It
+// presents the same notification contract as [notify.Var].
+//
+// Every update is written to a temporary file in the same directory,
+// which is then renamed over the target file. A reader of the file will
+// therefore see either the old or the new contents, never a partial
+// write. Updates are written while the underlying [notify.Var] is
+// locked, so the file is always consistent with the in-memory value.
+//
+// If [Config.Watch] is set, edits made to the file by other processes
+// will be loaded and then delivered to listeners, as though
+// [notify.Var.Set] had been called.
+type Var[T any] struct {
+	codec Codec[T]
+	path  string
+	perm  fs.FileMode
+	v     *notify.Var[T]
+
+	// Access to these fields is serialized by calling v.Update.
+	last struct {
+		data    []byte
+		modTime time.Time
+		size    int64
+	}
+
+	mu struct {
+		sync.Mutex
+		err error
+	}
+}
+
+var _ notify.Source[any] = (*Var[any])(nil)
+
+// Open constructs a Var from the file at the configured path. If the
+// file exists but cannot be decoded, an error will be returned. If a
+// watch interval is configured, the file will be polled by a goroutine
+// in the context until it begins to stop.
+func Open[T any](ctx *stopper.Context, cfg Config[T]) (*Var[T], error) {
+	if cfg.Path == "" {
+		return nil, errors.New("a path must be specified")
+	}
+	ret := &Var[T]{
+		codec: cfg.Codec,
+		path:  cfg.Path,
+		perm:  cfg.Perm,
+	}
+	if ret.codec == nil {
+		ret.codec = JSON[T]()
+	}
+	if ret.perm == 0 {
+		ret.perm = 0644
+	}
+
+	// The Var has not been shared yet, so no locking is necessary.
+	initial, found, err := ret.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		initial = cfg.Default
+	}
+	ret.v = notify.VarOf(initial)
+
+	if cfg.Watch > 0 {
+		ctx.Go(func(ctx *stopper.Context) error {
+			ret.watch(ctx, cfg.Watch)
+			return nil
+		})
+	}
+	return ret, nil
+}
+
+// Err returns the error, if any, encountered when the file was last
+// reloaded due to an external change. The Var will retain its previous
+// value if the file cannot be loaded. The error is cleared once the
+// file has been successfully reloaded or written.
+func (v *Var[T]) Err() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.mu.err
+}
+
+// Get returns the current value and a channel that will be closed when
+// the value has changed. See [notify.Var.Get].
+func (v *Var[T]) Get() (T, <-chan struct{}) {
+	return v.v.Get()
+}
+
+// Path returns the location of the file.
+func (v *Var[T]) Path() string {
+	return v.path
+}
+
+// Peek holds a read lock while the callback is invoked. See
+// [notify.Var.Peek].
+func (v *Var[T]) Peek(fn func(value T) error) (<-chan struct{}, error) {
+	return v.v.Peek(fn)
+}
+
+// Set writes the value to the file and then notifies any listeners. If
+// the file cannot be written, an error will be returned and the value
+// will be unchanged.
+func (v *Var[T]) Set(next T) (<-chan struct{}, error) {
+	_, ch, err := v.Update(func(T) (T, error) { return next, nil })
+	return ch, err
+}
+
+// Update atomically updates the stored value using the current value
+// as an input. The callback may return [notify.ErrNoUpdate] to take no
+// action. If the callback returns any other error, or if the file
+// cannot be written, no action is taken and the unchanged value is
+// returned.
+func (v *Var[T]) Update(fn func(old T) (new T, _ error)) (T, <-chan struct{}, error) {
+	return v.v.Update(func(old T) (T, error) {
+		next, err := fn(old)
+		if err != nil {
+			return old, err
+		}
+		if err := v.writeLocked(next); err != nil {
+			return old, err
+		}
+		return next, nil
+	})
+}
+
+// loadLocked reads the file if it has changed since it was last read
+// or written. If the file does not exist, changed will be false. If
+// the file has not been modified, errNotModified is returned. This
+// method must be called from within v.v.Update.
+func (v *Var[T]) loadLocked() (_ T, changed bool, _ error) {
+	var zero T
+	info, err := os.Stat(v.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return zero, false, nil
+	} else if err != nil {
+		return zero, false, err
+	}
+	if info.ModTime().Equal(v.last.modTime) && info.Size() == v.last.size {
+		return zero, false, errNotModified
+	}
+
+	data, err := os.ReadFile(v.path)
+	if err != nil {
+		return zero, false, err
+	}
+	// Record the stat even if the contents are invalid, so that the
+	// file won't be reloaded until it is edited again.
+	v.last.modTime, v.last.size = info.ModTime(), info.Size()
+	if bytes.Equal(data, v.last.data) {
+		return zero, false, nil
+	}
+	next, err := v.codec.Unmarshal(data)
+	if err != nil {
+		return zero, false, fmt.Errorf("could not decode %s: %w", v.path, err)
+	}
+	v.last.data = data
+	return next, true, nil
+}
+
+// reload feeds external changes to the file back into the Var.
+func (v *Var[T]) reload() {
+	_, _, err := v.v.Update(func(old T) (T, error) {
+		next, changed, err := v.loadLocked()
+		if err != nil {
+			return old, err
+		}
+		if !changed {
+			return old, notify.ErrNoUpdate
+		}
+		return next, nil
+	})
+	if errors.Is(err, errNotModified) {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.mu.err = err
+}
+
+// watch polls the file until the context begins to stop.
+func (v *Var[T]) watch(ctx *stopper.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			v.reload()
+		case <-ctx.Stopping():
+			return
+		}
+	}
+}
+
+// writeLocked atomically replaces the file. This method must be called
+// from within v.v.Update.
+func (v *Var[T]) writeLocked(next T) error {
+	data, err := v.codec.Marshal(next)
+	if err != nil {
+		return err
+	}
+
+	dir, base := filepath.Split(v.path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// Clean up the temporary file if we don't make it to the rename.
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(v.perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), v.path); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(v.path)
+	if err != nil {
+		return err
+	}
+	v.last.data = data
+	v.last.modTime, v.last.size = info.ModTime(), info.Size()
+
+	// The file is known to be valid again.
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.mu.err = nil
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package filevar
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/field-eng-powertools/stopper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVar(t *testing.T) {
+	r := require.New(t)
+	stop := stopper.WithContext(context.Background())
+	defer stop.Stop(0)
+
+	path := filepath.Join(t.TempDir(), "settings.json")
+	v, err := Open(stop, Config[map[string]int]{
+		Default: map[string]int{"default": 1},
+		Path:    path,
+		Perm:    0600,
+	})
+	r.NoError(err)
+	r.Equal(path, v.Path())
+
+	// The default is used, but the file isn't created.
+	found, ch := v.Get()
+	r.Equal(map[string]int{"default": 1}, found)
+	r.NoFileExists(path)
+
+	// Updates should be written through.
+	ch2, err := v.Set(map[string]int{"a": 1})
+	r.NoError(err)
+	<-ch
+	r.FileExists(path)
+	info, err := os.Stat(path)
+	r.NoError(err)
+	r.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	found, _, err = v.Update(func(old map[string]int) (map[string]int, error) {
+		return map[string]int{"a": old["a"] + 1}, nil
+	})
+	r.NoError(err)
+	r.Equal(map[string]int{"a": 2}, found)
+	<-ch2
+
+	// Verify that no temporary files are left behind.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	r.NoError(err)
+	r.Len(entries, 1)
+
+	// Reopening should see the persisted value.
+	reopened, err := Open(stop, Config[map[string]int]{Path: path})
+	r.NoError(err)
+	found, _ = reopened.Get()
+	r.Equal(map[string]int{"a": 2}, found)
+}
+
+func TestVarErrors(t *testing.T) {
+	r := require.New(t)
+	stop := stopper.WithContext(context.Background())
+	defer stop.Stop(0)
+
+	_, err := Open(stop, Config[int]{})
+	r.ErrorContains(err, "path")
+
+	// Invalid contents should prevent the file from being opened.
+	path := filepath.Join(t.TempDir(), "settings.json")
+	r.NoError(os.WriteFile(path, []byte("invalid"), 0644))
+	_, err = Open(stop, Config[int]{Path: path})
+	r.ErrorContains(err, "could not decode")
+
+	// If the file can't be written, the value should be unchanged.
+	v, err := Open(stop, Config[int]{
+		Default: 1,
+		Path:    filepath.Join(t.TempDir(), "missing", "settings.json"),
+	})
+	r.NoError(err)
+	_, err = v.Set(2)
+	r.Error(err)
+	found, _ := v.Get()
+	r.Equal(1, found)
+}
+
+func TestVarWatch(t *testing.T) {
+	r := require.New(t)
+	stop := stopper.WithContext(context.Background())
+
+	path := filepath.Join(t.TempDir(), "settings.json")
+	r.NoError(os.WriteFile(path, []byte("1"), 0644))
+	v, err := Open(stop, Config[int]{
+		Path:  path,
+		Watch: time.Millisecond,
+	})
+	r.NoError(err)
+	found, ch := v.Get()
+	r.Equal(1, found)
+
+	// An external edit should be delivered to listeners.
+	r.NoError(os.WriteFile(path, []byte("22"), 0644))
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		r.Fail("timed out waiting for reload")
+	}
+	found, ch = v.Get()
+	r.Equal(22, found)
+	r.NoError(v.Err())
+
+	// Invalid edits are reported, but do not change the value.
+	r.NoError(os.WriteFile(path, []byte("invalid"), 0644))
+	r.Eventually(func() bool { return v.Err() != nil }, 10*time.Second, time.Millisecond)
+	select {
+	case <-ch:
+		r.Fail("should not have been notified")
+	default:
+	}
+
+	// Our own writes should not be reloaded.
+	ch, err = v.Set(333)
+	r.NoError(err)
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-ch:
+		r.Fail("should not have been notified")
+	default:
+	}
+	r.NoError(v.Err())
+
+	stop.Stop(time.Second)
+	r.NoError(stop.Wait())
+}
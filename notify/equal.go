@@ -0,0 +1,84 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// SkipEqual causes the Var to ignore new values that are equal to the
+// current value, as determined by the == operator. That is, calls to
+// Set, Swap, Update, or CompareAndSet will not notify listeners or
+// change the version of the Var. [VarOf] will panic if the type of the
+// Var is not comparable. As with the == operator, comparing interface
+// values whose dynamic types are not comparable will panic. See
+// [VarOfFunc] for types that are not comparable.
+func SkipEqual() Option {
+	return func(o *options) {
+		o.skipEqual = true
+	}
+}
+
+// VarOfFunc is like [VarOf], but the Var will ignore new values for
+// which the function returns true when compared to the current value,
+// as with [SkipEqual]. This allows types such as slices or structs with
+// slice fields to be used. The function takes precedence over the
+// SkipEqual option.
+func VarOfFunc[T any](initial T, equal func(a, b T) bool, opts ...Option) *Var[T] {
+	return newVar(initial, equal, opts)
+}
+
+// SetChanged is like [Var.Set], but also returns false if the value was
+// ignored because it is equal to the current value. This method will
+// always return true unless the Var was constructed with [SkipEqual]
+// or by [VarOfFunc].
+func (v *Var[T]) SetChanged(next T) (<-chan struct{}, bool) {
+	snap, changed, _ := v.update(func(T) (T, error) { return next, nil })
+	return snap.updated, changed
+}
+
+// SwapChanged is like [Var.Swap], but also returns false if the value
+// was ignored because it is equal to the current value.
+func (v *Var[T]) SwapChanged(next T) (T, <-chan struct{}, bool) {
+	var ret T
+	snap, changed, _ := v.update(func(old T) (T, error) {
+		ret = old
+		return next, nil
+	})
+	return ret, snap.updated, changed
+}
+
+// UpdateChanged is like [Var.Update], but also returns whether the
+// value was replaced and listeners notified. It returns false if the
+// callback did not return a new value or if the new value was ignored
+// because it is equal to the current value.
+func (v *Var[T]) UpdateChanged(
+	fn func(old T) (new T, _ error),
+) (T, <-chan struct{}, bool, error) {
+	snap, changed, err := v.update(fn)
+	return snap.data, snap.updated, changed, err
+}
+
+// comparableEqual returns a comparison function that uses the ==
+// operator. It panics if T is not comparable.
+func comparableEqual[T any]() func(a, b T) bool {
+	if typ := reflect.TypeOf((*T)(nil)).Elem(); !typ.Comparable() {
+		panic(fmt.Errorf("SkipEqual used with non-comparable type %s", typ))
+	}
+	return func(a, b T) bool { return any(a) == any(b) }
+}
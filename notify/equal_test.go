@@ -0,0 +1,113 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipEqual(t *testing.T) {
+	r := require.New(t)
+
+	v := VarOf(1, SkipEqual(), KeepHistory(10))
+	sub := v.Subscribe(10, Block)
+	defer sub.Close()
+	_, ch := v.Get()
+
+	// Equal values are ignored.
+	ch2, changed := v.SetChanged(1)
+	r.False(changed)
+	r.Equal(ch, ch2)
+	r.False(closed(ch))
+	r.Equal(ch, v.Set(1))
+	old, ch2 := v.Swap(1)
+	r.Equal(1, old)
+	r.Equal(ch, ch2)
+	_, _, changed, err := v.UpdateChanged(func(old int) (int, error) { return old, nil })
+	r.NoError(err)
+	r.False(changed)
+	_, version, _ := v.GetVersioned()
+	r.Zero(version)
+	r.Len(v.History(), 1)
+
+	// Different values are not.
+	ch2, changed = v.SetChanged(2)
+	r.True(changed)
+	r.True(closed(ch))
+	r.False(closed(ch2))
+	r.Equal(2, <-sub.C())
+	_, version, _ = v.GetVersioned()
+	r.Equal(Version(1), version)
+
+	// Transactions also ignore unchanged values.
+	r.NoError(Transact(func(tx *Txn) error {
+		Stage(tx, v, 2)
+		return nil
+	}, v))
+	r.False(closed(ch2))
+
+	// UpdateChanged reports aborted updates.
+	_, _, changed, err = v.UpdateChanged(func(int) (int, error) { return 0, ErrNoUpdate })
+	r.NoError(err)
+	r.False(changed)
+	value, _, changed, err := v.UpdateChanged(func(old int) (int, error) { return old + 1, nil })
+	r.NoError(err)
+	r.True(changed)
+	r.Equal(3, value)
+
+	// A non-comparable type is a programming error.
+	r.Panics(func() { VarOf([]int{}, SkipEqual()) })
+}
+
+func TestVarOfFunc(t *testing.T) {
+	r := require.New(t)
+
+	v := VarOfFunc([]int{1, 2}, slices.Equal[[]int], KeepHistory(10))
+	_, ch := v.Get()
+	_, changed := v.SetChanged([]int{1, 2})
+	r.False(changed)
+	r.False(closed(ch))
+	_, changed = v.SetChanged([]int{1, 2, 3})
+	r.True(changed)
+	r.True(closed(ch))
+	r.Len(v.History(), 2)
+
+	// SwapChanged reports whether listeners were notified.
+	_, ch = v.Get()
+	old, ch2, changed := v.SwapChanged([]int{1, 2, 3})
+	r.Equal([]int{1, 2, 3}, old)
+	r.Equal(ch, ch2)
+	r.False(changed)
+	old, ch2, changed = v.SwapChanged([]int{4})
+	r.Equal([]int{1, 2, 3}, old)
+	r.True(changed)
+	r.True(closed(ch))
+	r.False(closed(ch2))
+
+	// Without the option, every call notifies.
+	var plain Var[int]
+	_, changed = plain.SetChanged(0)
+	r.True(changed)
+	_, _, changed = plain.SwapChanged(0)
+	r.True(changed)
+
+	// The function takes precedence over SkipEqual.
+	r.NotPanics(func() { VarOfFunc([]int{}, slices.Equal[[]int], SkipEqual()) })
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrHistoryDisabled is returned by [Var.Next] if the Var was not
+// constructed with the [KeepHistory] option.
+var ErrHistoryDisabled = errors.New("history is not enabled for this Var")
+
+// ErrHistoryTruncated is returned by [Var.Next] if the requested
+// revision is no longer retained in the history buffer.
+var ErrHistoryTruncated = errors.New("the requested revision has been discarded")
+
+// KeepHistory causes the Var to retain the most recent revisions of
+// its value, including the current one. This is intended as a
+// debugging aid. Note that the values in the history will be retained
+// in memory until they are evicted from the buffer.
+func KeepHistory(count int) Option {
+	return func(o *options) {
+		o.history = count
+	}
+}
+
+// A Revision records a value held by a [Var].
+type Revision[T any] struct {
+	Time    time.Time // The time at which the value was set.
+	Value   T
+	Version Version
+}
+
+// At returns the revision that was current at the given time. If
+// history is not enabled or the time predates the retained history,
+// false will be returned.
+func (v *Var[T]) At(t time.Time) (Revision[T], bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.mu.history == nil {
+		return Revision[T]{}, false
+	}
+	return v.mu.history.at(t)
+}
+
+// History returns the retained revisions, from oldest to newest. If
+// history is not enabled, this method will return nil.
+func (v *Var[T]) History() []Revision[T] {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.mu.history == nil {
+		return nil
+	}
+	return v.mu.history.list()
+}
+
+// Next returns the revision that immediately follows the given
+// version, waiting for it to be set if necessary. This allows every
+// update to be observed, provided that the caller keeps up with the
+// size of the history buffer:
+//
+//	for rev, err := v.Next(ctx, 0); err == nil; rev, err = v.Next(ctx, rev.Version) {
+//	  doSomething(rev.Value)
+//	}
+//
+// [ErrHistoryTruncated] will be returned if the revision has already
+// been evicted from the buffer.
+func (v *Var[T]) Next(ctx context.Context, after Version) (Revision[T], error) {
+	for {
+		v.mu.RLock()
+		if v.mu.history == nil {
+			v.mu.RUnlock()
+			return Revision[T]{}, ErrHistoryDisabled
+		}
+		rev, ok, err := v.mu.history.after(after)
+		ch := v.current.Load().updated
+		v.mu.RUnlock()
+
+		if err != nil || ok {
+			return rev, err
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return Revision[T]{}, ctx.Err()
+		}
+	}
+}
+
+// A history is a ring buffer of revisions. Since every change to the
+// version of a Var is recorded, the versions in the buffer are
+// contiguous.
+type history[T any] struct {
+	buf   []Revision[T]
+	count int // The number of elements in use.
+	start int // The index of the oldest element.
+}
+
+func newHistory[T any](size int) *history[T] {
+	return &history[T]{buf: make([]Revision[T], size)}
+}
+
+// add appends the revision, evicting the oldest element if the buffer
+// is full.
+func (h *history[T]) add(rev Revision[T]) {
+	if h.count < len(h.buf) {
+		h.buf[(h.start+h.count)%len(h.buf)] = rev
+		h.count++
+		return
+	}
+	h.buf[h.start] = rev
+	h.start = (h.start + 1) % len(h.buf)
+}
+
+// after returns the revision with the version following the one given.
+func (h *history[T]) after(version Version) (Revision[T], bool, error) {
+	if h.count == 0 || version >= h.get(h.count-1).Version {
+		return Revision[T]{}, false, nil
+	}
+	oldest := h.get(0).Version
+	if version+1 < oldest {
+		return Revision[T]{}, false, ErrHistoryTruncated
+	}
+	return h.get(int(version + 1 - oldest)), true, nil
+}
+
+// at returns the newest revision set at or before the given time.
+func (h *history[T]) at(t time.Time) (Revision[T], bool) {
+	// Find the first revision after the time.
+	idx := sort.Search(h.count, func(i int) bool { return h.get(i).Time.After(t) })
+	if idx == 0 {
+		return Revision[T]{}, false
+	}
+	return h.get(idx - 1), true
+}
+
+// get returns the i'th oldest revision.
+func (h *history[T]) get(i int) Revision[T] {
+	return h.buf[(h.start+i)%len(h.buf)]
+}
+
+func (h *history[T]) list() []Revision[T] {
+	ret := make([]Revision[T], h.count)
+	for i := range ret {
+		ret[i] = h.get(i)
+	}
+	return ret
+}
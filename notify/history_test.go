@@ -0,0 +1,122 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	r := require.New(t)
+
+	// History is disabled by default.
+	var zero Var[int]
+	r.Nil(zero.History())
+	_, ok := zero.At(time.Now())
+	r.False(ok)
+	_, err := zero.Next(context.Background(), 0)
+	r.ErrorIs(err, ErrHistoryDisabled)
+
+	before := time.Now()
+	v := VarOf(0, KeepHistory(3))
+	r.Equal([]int{0}, values(v.History()))
+
+	v.Set(1)
+	v.Notify() // Does not create a revision.
+	mid := time.Now()
+	v.Set(2)
+	v.Set(3)
+
+	// Only the last three revisions are retained.
+	hist := v.History()
+	r.Equal([]int{1, 2, 3}, values(hist))
+	for i, rev := range hist {
+		r.Equal(Version(i+1), rev.Version)
+		r.False(rev.Time.Before(before))
+	}
+
+	// Time-travel.
+	_, ok = v.At(before)
+	r.False(ok)
+	rev, ok := v.At(mid)
+	r.True(ok)
+	r.Equal(1, rev.Value)
+	rev, ok = v.At(time.Now())
+	r.True(ok)
+	r.Equal(3, rev.Value)
+
+	// Retrieve retained revisions.
+	rev, err = v.Next(context.Background(), 0)
+	r.NoError(err)
+	r.Equal(1, rev.Value)
+	r.Equal(Version(1), rev.Version)
+
+	// Evict the revision.
+	v.Set(4)
+	_, err = v.Next(context.Background(), 0)
+	r.ErrorIs(err, ErrHistoryTruncated)
+	rev, err = v.Next(context.Background(), 1)
+	r.NoError(err)
+	r.Equal(2, rev.Value)
+}
+
+func TestHistoryNext(t *testing.T) {
+	r := require.New(t)
+
+	const count = 1000
+	v := VarOf(0, KeepHistory(count))
+
+	// Ensure that no intermediate revisions are skipped.
+	done := make(chan []int)
+	go func() {
+		var seen []int
+		for rev, err := v.Next(context.Background(), 0); err == nil; rev, err = v.Next(
+			context.Background(), rev.Version) {
+			seen = append(seen, rev.Value)
+			if rev.Value == count {
+				break
+			}
+		}
+		done <- seen
+	}()
+	for i := 1; i <= count; i++ {
+		v.Set(i)
+	}
+	seen := <-done
+	r.Len(seen, count)
+	for i, value := range seen {
+		r.Equal(i+1, value)
+	}
+
+	// Verify cancellation while waiting.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err := v.Next(ctx, count)
+	r.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func values[T any](revs []Revision[T]) []T {
+	ret := make([]T, len(revs))
+	for i, rev := range revs {
+		ret[i] = rev.Value
+	}
+	return ret
+}
@@ -0,0 +1,270 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// A Map associates values with keys and provides notification channels
+// for changes to individual keys and to the map as a whole.
+//
+// Usage notes:
+//   - The zero value of Map is ready to use.
+//   - Map can be called concurrently from multiple goroutines.
+//   - A Map should not be copied.
+//   - Deleted keys are released immediately. The notification channel
+//     for an absent key is released once the key has been set. Channels
+//     for absent keys that have not been requested recently are
+//     released automatically once the number of such channels has
+//     doubled. A channel for an absent key may therefore occasionally
+//     be closed without the key having changed. Callers should call
+//     [Map.Get] again to check whether the key of interest has changed.
+//     A caller that does so will not be woken again until the number
+//     of channels grows further.
+type Map[K comparable, V any] struct {
+	mu struct {
+		sync.RWMutex
+		absent      map[K]*absentEntry // Channels for absent keys.
+		absentGen   uint64             // Incremented when absent is swept.
+		absentLimit int                // The size of absent that triggers a sweep.
+		evicted     map[K]struct{}     // Keys released by recent sweeps.
+		entries     map[K]*mapEntry[V]
+		updated     chan struct{} // Created on demand.
+	}
+}
+
+// An absentEntry holds the notification channel for an absent key.
+type absentEntry struct {
+	gen     atomic.Uint64 // The value of absentGen when last requested.
+	updated chan struct{}
+}
+
+// minAbsent is the number of notification channels for absent keys
+// that a Map will retain, regardless of the number of keys present.
+const minAbsent = 64
+
+type mapEntry[V any] struct {
+	updated chan struct{} // Created on demand.
+	value   V
+}
+
+// Delete removes the key from the map, returning true if it was
+// present.
+func (m *Map[K, V]) Delete(key K) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.mu.entries[key]
+	if !ok {
+		return false
+	}
+	delete(m.mu.entries, key)
+	entry.notifyLocked()
+	m.notifyLocked()
+	return true
+}
+
+// Get returns the value associated with the key and a channel that
+// will be closed when the key has changed. If the key is not present,
+// the zero value and false will be returned.
+func (m *Map[K, V]) Get(key K) (V, bool, <-chan struct{}) {
+	m.mu.RLock()
+	entry, ok := m.mu.entries[key]
+	if ok && entry.updated != nil {
+		defer m.mu.RUnlock()
+		return entry.value, true, entry.updated
+	}
+	if !ok {
+		if absent := m.mu.absent[key]; absent != nil {
+			defer m.mu.RUnlock()
+			absent.gen.Store(m.mu.absentGen)
+			var zero V
+			return zero, false, absent.updated
+		}
+	}
+	m.mu.RUnlock()
+
+	// A notification channel must be created.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok = m.mu.entries[key]
+	if ok {
+		return entry.value, true, entry.currentLocked()
+	}
+	var zero V
+	return zero, false, m.absentLocked(key)
+}
+
+// Len returns the number of keys in the map.
+func (m *Map[K, V]) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.mu.entries)
+}
+
+// Set associates the value with the key and notifies any listeners.
+// The notification channel for the key is returned.
+func (m *Map[K, V]) Set(key K, value V) <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setLocked(key, value).currentLocked()
+}
+
+// Snapshot returns a copy of the contents of the map and a channel
+// that will be closed when any key has changed.
+func (m *Map[K, V]) Snapshot() (map[K]V, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make(map[K]V, len(m.mu.entries))
+	for key, entry := range m.mu.entries {
+		ret[key] = entry.value
+	}
+	return ret, m.currentLocked()
+}
+
+// Update atomically updates the value associated with the key, using
+// the current value as an input. The callback may return [ErrNoUpdate]
+// to take no action; this error will not be returned to the caller. If
+// the callback returns any other error, no action is taken and the
+// unchanged value is returned.
+func (m *Map[K, V]) Update(
+	key K, fn func(old V, ok bool) (new V, _ error),
+) (V, <-chan struct{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.mu.entries[key]
+	var old V
+	if ok {
+		old = entry.value
+	}
+	next, err := fn(old, ok)
+	if err == nil {
+		entry = m.setLocked(key, next)
+	} else if errors.Is(err, ErrNoUpdate) {
+		err = nil
+	}
+	if entry == nil {
+		// The key remains absent.
+		return old, m.absentLocked(key), err
+	}
+	return entry.value, entry.currentLocked(), err
+}
+
+// absentLocked returns the notification channel for a key that is not
+// present in the map. If there are too many channels, those which
+// have not been requested since the previous sweep will be closed and
+// released first.
+func (m *Map[K, V]) absentLocked(key K) <-chan struct{} {
+	if absent := m.mu.absent[key]; absent != nil {
+		absent.gen.Store(m.mu.absentGen)
+		return absent.updated
+	}
+	if _, ok := m.mu.evicted[key]; ok {
+		// The channel was released while still in use, so allow
+		// room for it to be retained by the next sweep.
+		delete(m.mu.evicted, key)
+		m.mu.absentLimit += 2
+	} else if len(m.mu.absent) >= max(minAbsent, len(m.mu.entries), m.mu.absentLimit) {
+		m.sweepAbsentLocked()
+	}
+	if m.mu.absent == nil {
+		m.mu.absent = make(map[K]*absentEntry)
+	}
+	absent := &absentEntry{updated: make(chan struct{})}
+	absent.gen.Store(m.mu.absentGen)
+	m.mu.absent[key] = absent
+	return absent.updated
+}
+
+// sweepAbsentLocked closes and releases the channels for absent keys
+// which have not been requested since the previous sweep. Waiters will
+// call Get again, which recreates the channels that are still of
+// interest.
+func (m *Map[K, V]) sweepAbsentLocked() {
+	if m.mu.evicted == nil || len(m.mu.evicted) > m.mu.absentLimit {
+		// Forget keys that were released long ago.
+		m.mu.evicted = make(map[K]struct{})
+	}
+	for key, absent := range m.mu.absent {
+		if absent.gen.Load() < m.mu.absentGen {
+			close(absent.updated)
+			delete(m.mu.absent, key)
+			m.mu.evicted[key] = struct{}{}
+		}
+	}
+	m.mu.absentGen++
+	// Allow the retained channels to double before sweeping again, so
+	// that the cost of sweeping is amortized.
+	m.mu.absentLimit = max(m.mu.absentLimit, 2*len(m.mu.absent))
+}
+
+// currentLocked returns the notification channel for the whole map.
+func (m *Map[K, V]) currentLocked() <-chan struct{} {
+	if m.mu.updated == nil {
+		m.mu.updated = make(chan struct{})
+	}
+	return m.mu.updated
+}
+
+// notifyLocked closes the whole-map notification channel. A new
+// channel will be created when next requested.
+func (m *Map[K, V]) notifyLocked() {
+	if m.mu.updated != nil {
+		close(m.mu.updated)
+		m.mu.updated = nil
+	}
+}
+
+func (m *Map[K, V]) setLocked(key K, value V) *mapEntry[V] {
+	entry, ok := m.mu.entries[key]
+	if ok {
+		entry.notifyLocked()
+	} else {
+		if m.mu.entries == nil {
+			m.mu.entries = make(map[K]*mapEntry[V])
+		}
+		entry = &mapEntry[V]{}
+		m.mu.entries[key] = entry
+		if absent, ok := m.mu.absent[key]; ok {
+			close(absent.updated)
+			delete(m.mu.absent, key)
+		}
+		delete(m.mu.evicted, key)
+	}
+	entry.value = value
+	m.notifyLocked()
+	return entry
+}
+
+// currentLocked returns the notification channel for the entry.
+func (e *mapEntry[V]) currentLocked() <-chan struct{} {
+	if e.updated == nil {
+		e.updated = make(chan struct{})
+	}
+	return e.updated
+}
+
+// notifyLocked closes the entry's notification channel. A new channel
+// will be created when next requested.
+func (e *mapEntry[V]) notifyLocked() {
+	if e.updated != nil {
+		close(e.updated)
+		e.updated = nil
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestMap(t *testing.T) {
+	r := require.New(t)
+
+	var m Map[string, int]
+	r.Zero(m.Len())
+
+	// Absent keys.
+	value, ok, absentCh := m.Get("a")
+	r.Zero(value)
+	r.False(ok)
+	r.False(m.Delete("a"))
+	snap, mapCh := m.Snapshot()
+	r.Empty(snap)
+
+	// Setting a key notifies the whole map.
+	aCh := m.Set("a", 1)
+	r.True(closed(absentCh))
+	r.True(closed(mapCh))
+	value, ok, aCh2 := m.Get("a")
+	r.Equal(1, value)
+	r.True(ok)
+	r.Equal(aCh, aCh2)
+
+	// Changes to other keys don't affect a.
+	_, mapCh = m.Snapshot()
+	bCh := m.Set("b", 2)
+	r.False(closed(aCh))
+	r.True(closed(mapCh))
+	snap, _ = m.Snapshot()
+	r.Equal(map[string]int{"a": 1, "b": 2}, snap)
+	r.Equal(2, m.Len())
+
+	// Update an existing key.
+	value, aCh3, err := m.Update("a", func(old int, ok bool) (int, error) {
+		r.True(ok)
+		return old + 10, nil
+	})
+	r.NoError(err)
+	r.Equal(11, value)
+	r.True(closed(aCh))
+	r.False(closed(aCh3))
+
+	// Update an absent key.
+	value, _, err = m.Update("c", func(old int, ok bool) (int, error) {
+		r.False(ok)
+		return 3, nil
+	})
+	r.NoError(err)
+	r.Equal(3, value)
+
+	// No-op and failed updates.
+	value, _, err = m.Update("a", func(int, bool) (int, error) { return 0, ErrNoUpdate })
+	r.NoError(err)
+	r.Equal(11, value)
+	boom := errors.New("boom")
+	value, _, err = m.Update("d", func(int, bool) (int, error) { return 0, boom })
+	r.ErrorIs(err, boom)
+	r.Zero(value)
+	_, ok, _ = m.Get("d")
+	r.False(ok)
+	r.False(closed(aCh3))
+
+	// Delete notifies the key and the map.
+	_, mapCh = m.Snapshot()
+	r.True(m.Delete("b"))
+	r.True(closed(bCh))
+	r.True(closed(mapCh))
+	_, ok, _ = m.Get("b")
+	r.False(ok)
+	r.Equal(2, m.Len())
+}
+
+func TestMapAbsent(t *testing.T) {
+	r := require.New(t)
+
+	var m Map[string, int]
+	_, ok, aCh := m.Get("a")
+	r.False(ok)
+	_, _, aCh2 := m.Get("a")
+	r.Equal(aCh, aCh2)
+
+	// Changes to other keys do not affect an absent key.
+	m.Set("b", 1)
+	r.True(m.Delete("b"))
+	r.False(closed(aCh))
+
+	// The channel is released once the key has been set.
+	m.Set("a", 1)
+	r.True(closed(aCh))
+	r.Empty(m.mu.absent)
+
+	// Idle channels are released once there are too many of them.
+	var chans []<-chan struct{}
+	for i := 0; i < 16*minAbsent; i++ {
+		_, _, ch := m.Get(fmt.Sprintf("absent%d", i))
+		chans = append(chans, ch)
+	}
+	r.LessOrEqual(len(m.mu.absent), 2*minAbsent)
+	r.LessOrEqual(len(m.mu.evicted), 2*minAbsent)
+	r.True(closed(chans[0]))
+	r.False(closed(chans[len(chans)-1]))
+
+	// The number retained grows with the number of keys present.
+	var big Map[int, int]
+	for i := 0; i < 2*minAbsent; i++ {
+		big.Set(i, i)
+	}
+	_, _, first := big.Get(-1)
+	for i := 1; i < 2*minAbsent; i++ {
+		big.Get(-1 - i)
+	}
+	r.Len(big.mu.absent, 2*minAbsent)
+	r.False(closed(first))
+}
+
+func TestMapAbsentWaiters(t *testing.T) {
+	r := require.New(t)
+
+	// Waiters for more than minAbsent keys are not repeatedly woken,
+	// even though no keys are being set.
+	const waiters = 4 * minAbsent
+	var m Map[int, int]
+	var wakeups atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				_, _, ch := m.Get(i)
+				select {
+				case <-ch:
+					wakeups.Add(1)
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	r.LessOrEqual(wakeups.Load(), int64(waiters))
+	r.LessOrEqual(len(m.mu.absent), waiters)
+}
+
+func TestMapConcurrent(t *testing.T) {
+	r := require.New(t)
+
+	const keys = 10
+	const count = 100
+	var m Map[string, int]
+	var wg sync.WaitGroup
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key%d", i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < count; j++ {
+				_, _, err := m.Update(key, func(old int, _ bool) (int, error) { return old + 1, nil })
+				r.NoError(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				value, _, ch := m.Get(key)
+				if value == count {
+					return
+				}
+				<-ch
+			}
+		}()
+	}
+	wg.Wait()
+
+	snap, _ := m.Snapshot()
+	r.Len(snap, keys)
+	for _, value := range snap {
+		r.Equal(count, value)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrOverflow is returned from [Subscription.Err] when a subscription
+// using the [Fail] policy could not keep up with updates.
+var ErrOverflow = errors.New("subscription buffer overflow")
+
+// Overflow determines the behavior of a [Subscription] when its buffer
+// is full.
+type Overflow int
+
+// Supported overflow policies.
+const (
+	// Block causes the caller that is updating the Var to wait until
+	// there is room in the buffer. Other writers to the Var will also
+	// be delayed, but readers will not.
+	Block Overflow = iota
+	// DropOldest discards the oldest value in the buffer.
+	DropOldest
+	// Fail closes the subscription, which will then report
+	// [ErrOverflow].
+	Fail
+)
+
+// A Subscription receives every value that is set in a [Var], in
+// order, via a bounded buffer. This is in contrast to [Var.Get], which
+// allows a consumer to sample the most recent value.
+//
+// A Subscription should be closed once it is no longer needed.
+type Subscription[T any] struct {
+	ch       chan T        // Closed while holding mu.
+	closed   chan struct{} // Closed when no more values will be sent.
+	closing  sync.Once
+	err      atomic.Pointer[error]
+	overflow Overflow
+	owner    *Var[T]
+
+	mu struct {
+		sync.Mutex // Held while sending to ch.
+		shut       bool
+	}
+}
+
+// Subscribe returns a Subscription that will receive all values
+// subsequently set by [Var.Set], [Var.Swap], or [Var.Update]. The
+// capacity determines the size of the buffer and the overflow policy
+// determines what happens when the buffer is full. Calls to
+// [Var.Notify] do not generate a value.
+func (v *Var[T]) Subscribe(capacity int, overflow Overflow) *Subscription[T] {
+	ret := &Subscription[T]{
+		ch:       make(chan T, capacity),
+		closed:   make(chan struct{}),
+		overflow: overflow,
+		owner:    v,
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.mu.subs = append(v.mu.subs, ret)
+	return ret
+}
+
+// C returns a channel that emits the values set in the Var. The
+// channel will be closed once the Subscription has been closed and any
+// buffered values have been consumed.
+func (s *Subscription[T]) C() <-chan T { return s.ch }
+
+// Close stops the delivery of values. Values that have already been
+// buffered may still be received from the channel returned by C. It is
+// safe to call this method multiple times.
+func (s *Subscription[T]) Close() {
+	// Unblock any pending deliveries.
+	s.markClosed(nil)
+
+	s.owner.mu.Lock()
+	for i, sub := range s.owner.mu.subs {
+		if sub == s {
+			s.owner.mu.subs = append(s.owner.mu.subs[:i], s.owner.mu.subs[i+1:]...)
+			break
+		}
+	}
+	s.owner.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shutLocked()
+}
+
+// Done returns a channel that is closed when the Subscription will not
+// receive any more values.
+func (s *Subscription[T]) Done() <-chan struct{} { return s.closed }
+
+// Err returns [ErrOverflow] if the Subscription was closed because it
+// could not keep up with updates. Otherwise, it returns nil.
+func (s *Subscription[T]) Err() error {
+	if err := s.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// deliver sends the value to the subscriber.
+func (s *Subscription[T]) deliver(value T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isClosed() {
+		s.shutLocked()
+		return
+	}
+	select {
+	case s.ch <- value:
+		return
+	default:
+	}
+
+	switch s.overflow {
+	case Block:
+		select {
+		case s.ch <- value:
+		case <-s.closed:
+			s.shutLocked()
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.ch <- value:
+				return
+			default:
+			}
+			// The consumer may have drained the channel, so this
+			// must not block.
+			select {
+			case <-s.ch:
+			default:
+			}
+		}
+	default:
+		s.markClosed(ErrOverflow)
+		s.shutLocked()
+	}
+}
+
+// isClosed returns true if the Subscription has been closed.
+func (s *Subscription[T]) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// markClosed closes the closed channel, recording the error.
+func (s *Subscription[T]) markClosed(err error) {
+	s.closing.Do(func() {
+		if err != nil {
+			s.err.Store(&err)
+		}
+		close(s.closed)
+	})
+}
+
+// shutLocked closes the value channel.
+func (s *Subscription[T]) shutLocked() {
+	if !s.mu.shut {
+		s.mu.shut = true
+		close(s.ch)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribeBlock(t *testing.T) {
+	r := require.New(t)
+
+	var v Var[int]
+	sub := v.Subscribe(1, Block)
+
+	const count = 1000
+	go func() {
+		for i := 1; i <= count; i++ {
+			switch i % 3 {
+			case 0:
+				v.Set(i)
+			case 1:
+				v.Swap(i)
+			case 2:
+				_, _, _ = v.Update(func(int) (int, error) { return i, nil })
+			}
+		}
+		// These should not generate values.
+		v.Notify()
+		_, _, _ = v.Update(func(int) (int, error) { return -1, ErrNoUpdate })
+		_, _, _ = v.Update(func(int) (int, error) { return -1, errors.New("ignored") })
+		v.Set(count + 1)
+	}()
+
+	// Every value is seen, in order.
+	for i := 1; i <= count+1; i++ {
+		select {
+		case found := <-sub.C():
+			r.Equal(i, found)
+		case <-time.After(time.Second):
+			r.Fail("timed out waiting for value")
+		}
+	}
+
+	sub.Close()
+	sub.Close() // Idempotent.
+	_, open := <-sub.C()
+	r.False(open)
+	r.NoError(sub.Err())
+
+	// Verify that the subscription was removed.
+	v.mu.RLock()
+	r.Empty(v.mu.subs)
+	v.mu.RUnlock()
+	v.Set(0)
+}
+
+func TestSubscribeBlockClose(t *testing.T) {
+	r := require.New(t)
+
+	var v Var[int]
+	sub := v.Subscribe(0, Block)
+
+	// A blocked writer is released when the subscription is closed.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v.Set(1)
+	}()
+	r.Eventually(func() bool {
+		v.mu.RLock()
+		defer v.mu.RUnlock()
+		return v.mu.lastPublish != nil
+	}, time.Second, time.Millisecond)
+
+	// Readers are not blocked.
+	_, _ = v.Get()
+
+	sub.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		r.Fail("writer was not released")
+	}
+	select {
+	case <-sub.Done():
+	default:
+		r.Fail("Done should be closed")
+	}
+}
+
+func TestSubscribeDropOldest(t *testing.T) {
+	r := require.New(t)
+
+	var v Var[int]
+	sub := v.Subscribe(2, DropOldest)
+	defer sub.Close()
+	for i := 1; i <= 10; i++ {
+		v.Set(i)
+	}
+	r.Equal(9, <-sub.C())
+	r.Equal(10, <-sub.C())
+	r.NoError(sub.Err())
+}
+
+func TestSubscribeFail(t *testing.T) {
+	r := require.New(t)
+
+	var v Var[int]
+	sub := v.Subscribe(2, Fail)
+	for i := 1; i <= 10; i++ {
+		v.Set(i)
+	}
+
+	// Buffered values are still available.
+	var found []int
+	for value := range sub.C() {
+		found = append(found, value)
+	}
+	r.Equal([]int{1, 2}, found)
+	r.ErrorIs(sub.Err(), ErrOverflow)
+
+	// The failed subscription is pruned on the next update.
+	v.Set(11)
+	v.mu.RLock()
+	r.Empty(v.mu.subs)
+	v.mu.RUnlock()
+	sub.Close()
+}
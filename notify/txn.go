@@ -0,0 +1,206 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// nextID is used to assign a lock-ordering identifier to each Var.
+var nextID atomic.Uint64
+
+// A Participant is a variable that may be updated by a [Group]. It is
+// implemented by [Var].
+type Participant interface {
+	commitLocked(value any) (publish func())
+	lock()
+	lockID() uint64
+	readLocked() any
+	unlock()
+}
+
+var _ Participant = (*Var[any])(nil)
+
+// A Group allows several variables to be updated atomically, subject
+// to validators which enforce invariants that span the variables.
+//
+// The variables are always locked in a consistent order, so Groups
+// with overlapping membership may be used concurrently without
+// deadlock. Validators are only applied to updates made through the
+// Group; calling [Var.Set] directly will bypass them. A reader that
+// calls [Var.Get] on several members of a Group may observe a
+// transaction that is only partially committed.
+type Group struct {
+	validators []func(tx *Txn) error
+	vars       []Participant // Sorted by lockID.
+}
+
+// NewGroup constructs a Group over the given variables. Duplicate
+// variables are ignored.
+func NewGroup(vars ...Participant) *Group {
+	seen := make(map[Participant]struct{}, len(vars))
+	sorted := make([]Participant, 0, len(vars))
+	for _, v := range vars {
+		if _, dup := seen[v]; dup {
+			continue
+		}
+		seen[v] = struct{}{}
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].lockID() < sorted[j].lockID() })
+	return &Group{vars: sorted}
+}
+
+// Transact is a convenience method for calling [Group.Update] on an
+// ad-hoc Group.
+func Transact(fn func(tx *Txn) error, vars ...Participant) error {
+	return NewGroup(vars...).Update(fn)
+}
+
+// Update locks every variable in the Group and invokes the callback,
+// which may use [Read] and [Stage] to read and stage new values. The
+// validators are then invoked with the staged values. If the callback
+// and all validators succeed, the staged values are committed and each
+// changed variable will notify its listeners once. The callback or a
+// validator may return [ErrNoUpdate] to abort the transaction without
+// returning an error. Any other error aborts the transaction and will
+// be returned.
+func (g *Group) Update(fn func(tx *Txn) error) error {
+	publish, err := g.update(fn)
+	for _, fn := range publish {
+		fn()
+	}
+	if errors.Is(err, ErrNoUpdate) {
+		err = nil
+	}
+	return err
+}
+
+// Validate adds a callback that is invoked with the staged values of
+// each transaction. The callback should use [Read] to inspect the
+// values and return an error to abort the transaction. Validate must
+// not be called concurrently with Update.
+func (g *Group) Validate(fn func(tx *Txn) error) {
+	g.validators = append(g.validators, fn)
+}
+
+// update runs the transaction while holding the locks and returns the
+// functions that will publish values to subscribers once the locks
+// have been released.
+func (g *Group) update(fn func(tx *Txn) error) ([]func(), error) {
+	for _, v := range g.vars {
+		v.lock()
+	}
+	defer func() {
+		for i := len(g.vars) - 1; i >= 0; i-- {
+			g.vars[i].unlock()
+		}
+	}()
+
+	tx := &Txn{
+		group:  g,
+		staged: make(map[Participant]any, len(g.vars)),
+	}
+	if err := fn(tx); err != nil {
+		return nil, err
+	}
+	if len(tx.staged) == 0 {
+		return nil, nil
+	}
+	for _, validate := range g.validators {
+		if err := validate(tx); err != nil {
+			return nil, err
+		}
+	}
+
+	var ret []func()
+	for _, v := range g.vars {
+		if value, ok := tx.staged[v]; ok {
+			ret = append(ret, v.commitLocked(value))
+		}
+	}
+	return ret, nil
+}
+
+// A Txn is passed to the callbacks used by [Group.Update].
+type Txn struct {
+	group  *Group
+	staged map[Participant]any
+}
+
+// Read returns the value of the variable within the transaction. That
+// is, if a new value has been staged, it will be returned. This
+// function will panic if the variable is not a member of the
+// transaction's Group.
+func Read[T any](tx *Txn, v *Var[T]) T {
+	tx.check(v)
+	if value, ok := tx.staged[v]; ok {
+		return value.(T)
+	}
+	return v.readLocked().(T)
+}
+
+// Stage sets the value that will be assigned to the variable if the
+// transaction commits. This function will panic if the variable is not
+// a member of the transaction's Group.
+func Stage[T any](tx *Txn, v *Var[T], next T) {
+	tx.check(v)
+	tx.staged[v] = next
+}
+
+// check panics if the variable is not a member of the Group.
+func (tx *Txn) check(v Participant) {
+	for _, member := range tx.group.vars {
+		if member == v {
+			return
+		}
+	}
+	panic(fmt.Errorf("variable %p is not a member of the transaction", v))
+}
+
+// commitLocked implements [Participant].
+func (v *Var[T]) commitLocked(value any) (publish func()) {
+	return v.setLocked(value.(T))
+}
+
+// lock implements [Participant].
+func (v *Var[T]) lock() {
+	v.mu.Lock()
+}
+
+// lockID implements [Participant]. Identifiers are assigned lazily to
+// allow the zero value of Var to be used.
+func (v *Var[T]) lockID() uint64 {
+	if id := v.id.Load(); id != 0 {
+		return id
+	}
+	v.id.CompareAndSwap(0, nextID.Add(1))
+	return v.id.Load()
+}
+
+// readLocked implements [Participant].
+func (v *Var[T]) readLocked() any {
+	return v.currentLocked().data
+}
+
+// unlock implements [Participant].
+func (v *Var[T]) unlock() {
+	v.mu.Unlock()
+}
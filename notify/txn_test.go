@@ -0,0 +1,141 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup(t *testing.T) {
+	r := require.New(t)
+
+	low := VarOf(0)
+	high := VarOf(10)
+	var label Var[string]
+	g := NewGroup(high, low, &label, low)
+	g.Validate(func(tx *Txn) error {
+		if Read(tx, low) > Read(tx, high) {
+			return errors.New("low exceeds high")
+		}
+		return nil
+	})
+	sub := low.Subscribe(10, Block)
+	defer sub.Close()
+
+	// Commit both values.
+	_, lowCh := low.Get()
+	_, highCh := high.Get()
+	_, labelCh := label.Get()
+	r.NoError(g.Update(func(tx *Txn) error {
+		Stage(tx, high, 20)
+		Stage(tx, low, 5)
+		Stage(tx, low, 15) // Only the last value is committed.
+		r.Equal(15, Read(tx, low))
+		return nil
+	}))
+	<-lowCh
+	<-highCh
+	select {
+	case <-labelCh:
+		r.Fail("unchanged variable should not be notified")
+	default:
+	}
+	lowValue, lowVersion, _ := low.GetVersioned()
+	r.Equal(15, lowValue)
+	r.Equal(Version(1), lowVersion)
+	highValue, _ := high.Get()
+	r.Equal(20, highValue)
+	r.Equal(15, <-sub.C())
+
+	// A validation failure aborts the transaction.
+	err := g.Update(func(tx *Txn) error {
+		Stage(tx, low, 100)
+		Stage(tx, &label, "ignored")
+		return nil
+	})
+	r.ErrorContains(err, "low exceeds high")
+	lowValue, _ = low.Get()
+	r.Equal(15, lowValue)
+	labelValue, _ := label.Get()
+	r.Empty(labelValue)
+
+	// ErrNoUpdate aborts without an error.
+	r.NoError(g.Update(func(tx *Txn) error {
+		Stage(tx, low, 0)
+		return ErrNoUpdate
+	}))
+	lowValue, _ = low.Get()
+	r.Equal(15, lowValue)
+
+	// Other errors are returned.
+	boom := errors.New("boom")
+	r.ErrorIs(g.Update(func(*Txn) error { return boom }), boom)
+
+	// Accessing a non-member is a programming error.
+	other := VarOf(0)
+	r.Panics(func() {
+		_ = g.Update(func(tx *Txn) error {
+			Stage(tx, other, 1)
+			return nil
+		})
+	})
+
+	// Locks are released after a panic.
+	r.NoError(g.Update(func(tx *Txn) error { return nil }))
+}
+
+// Verify that groups with overlapping membership do not deadlock and
+// that their updates are atomic.
+func TestTransactConcurrent(t *testing.T) {
+	r := require.New(t)
+
+	const count = 1000
+	a := VarOf(0)
+	b := VarOf(0)
+	transfer := func(from, to *Var[int]) {
+		r.NoError(Transact(func(tx *Txn) error {
+			Stage(tx, from, Read(tx, from)-1)
+			Stage(tx, to, Read(tx, to)+1)
+			return nil
+		}, from, to))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < count; i++ {
+			transfer(a, b)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < count; i++ {
+			transfer(b, a)
+		}
+	}()
+	wg.Wait()
+
+	r.NoError(Transact(func(tx *Txn) error {
+		r.Zero(Read(tx, a) + Read(tx, b))
+		return nil
+	}, a, b))
+}
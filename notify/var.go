@@ -20,12 +20,32 @@ package notify
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // ErrNoUpdate is a sentinel value that can be returned by the callback
 // passed to [Var.Update].
 var ErrNoUpdate = errors.New("no update required")
 
+// A Source provides the current value of some variable and a channel
+// that will be closed when the value has changed. It is implemented by
+// [Var] and by other types that present the same notification
+// contract as [Var.Get].
+type Source[T any] interface {
+	Get() (T, <-chan struct{})
+}
+
+var _ Source[any] = (*Var[any])(nil)
+
+// An Option configures a [Var] created by [VarOf].
+type Option func(o *options)
+
+type options struct {
+	history   int  // Set by KeepHistory.
+	skipEqual bool // Set by SkipEqual.
+}
+
 // A Var holds a value that can be set or retrieved. It also provides
 // a channel that indicates when the value has changed.
 //
@@ -35,19 +55,58 @@ var ErrNoUpdate = errors.New("no update required")
 //   - A Var should not be copied.
 //   - If the value contained by the Var is mutable, the [Var.Peek] and
 //     [Var.Update] methods should be used to ensure race-free behavior.
+//   - By default, every call to Set, Swap, or Update notifies listeners,
+//     even if the value is unchanged. See [SkipEqual].
+//
+// Reads of a Var are wait-free. The value, version, and notification
+// channel are stored as an immutable snapshot that is atomically
+// replaced by writers, so calls to [Var.Get] never contend with one
+// another or with writers.
 type Var[T any] struct {
+	// The current state of the Var. This is only replaced while mu is
+	// held for writing, but may be loaded at any time. It will be nil
+	// for a zero-value Var until it is first accessed.
+	current atomic.Pointer[snapshot[T]]
+	// If non-nil, values equal to the current value are ignored.
+	equal func(a, b T) bool
+	// Determines the order in which Vars are locked by a Group.
+	id atomic.Uint64
+
 	mu struct {
 		sync.RWMutex
-		data    T
-		updated chan struct{}
+		history     *history[T]   // Nil unless enabled.
+		lastPublish chan struct{} // Closed when delivery has completed.
+		subs        []*Subscription[T]
 	}
 }
 
+// A snapshot is an immutable view of the state of a Var.
+type snapshot[T any] struct {
+	data    T
+	updated chan struct{}
+	version Version
+}
+
 // VarOf constructs a Var set to the initial value.
-func VarOf[T any](initial T) *Var[T] {
-	ret := &Var[T]{}
-	ret.mu.data = initial
-	ret.mu.updated = make(chan struct{})
+func VarOf[T any](initial T, opts ...Option) *Var[T] {
+	return newVar(initial, nil, opts)
+}
+
+// newVar implements VarOf and VarOfFunc.
+func newVar[T any](initial T, equal func(a, b T) bool, opts []Option) *Var[T] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if equal == nil && o.skipEqual {
+		equal = comparableEqual[T]()
+	}
+	ret := &Var[T]{equal: equal}
+	ret.current.Store(&snapshot[T]{data: initial, updated: make(chan struct{})})
+	if o.history > 0 {
+		ret.mu.history = newHistory[T](o.history)
+		ret.mu.history.add(Revision[T]{Time: time.Now(), Value: initial})
+	}
 	return ret
 }
 
@@ -55,7 +114,8 @@ func VarOf[T any](initial T) *Var[T] {
 // that will be closed the next time that Set or Update is called. This
 // API does not guarantee that a loop as shown below will see every
 // update made to the Var.  Rather, it allows a consumer to sample the
-// most current value available.
+// most current value available. Use [Var.Subscribe] to receive every
+// update.
 //
 //	for value, valueUpdated := v.Get(); ;{
 //	  doSomething(value)
@@ -67,20 +127,8 @@ func VarOf[T any](initial T) *Var[T] {
 //	  }
 //	}
 func (v *Var[T]) Get() (T, <-chan struct{}) {
-	v.mu.RLock()
-	data, ch := v.mu.data, v.mu.updated
-	v.mu.RUnlock()
-	if ch != nil {
-		return data, ch
-	}
-
-	// Get called on zero value, may need to initialize.
-	v.mu.Lock()
-	defer v.mu.Unlock()
-	if v.mu.updated == nil {
-		v.mu.updated = make(chan struct{})
-	}
-	return v.mu.data, v.mu.updated
+	data, _, ch := v.GetVersioned()
+	return data, ch
 }
 
 // Notify behaves as though Set was called with the current value.
@@ -96,9 +144,7 @@ func (v *Var[T]) Notify() {
 // will return the notification channel associated with the current
 // value of the Var.
 func (v *Var[T]) Peek(fn func(value T) error) (<-chan struct{}, error) {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
-	return v.mu.updated, fn(v.mu.data)
+	return v.PeekVersioned(func(value T, _ Version) error { return fn(value) })
 }
 
 // Set updates the value and notifies any listeners. The notification
@@ -106,24 +152,15 @@ func (v *Var[T]) Peek(fn func(value T) error) (<-chan struct{}, error) {
 // set the value and receive a notification if another caller has
 // subsequently updated it.
 func (v *Var[T]) Set(next T) <-chan struct{} {
-	v.mu.Lock()
-	defer v.mu.Unlock()
-
-	v.mu.data = next
-	v.notifyLocked()
-	return v.mu.updated
+	_, ch := v.SetVersioned(next)
+	return ch
 }
 
 // Swap returns the current value and a channel that will be closed
 // when the next value has been replaced.
 func (v *Var[T]) Swap(next T) (T, <-chan struct{}) {
-	v.mu.Lock()
-	defer v.mu.Unlock()
-
-	ret := v.mu.data
-	v.mu.data = next
-	v.notifyLocked()
-	return ret, v.mu.updated
+	ret, _, ch := v.SwapVersioned(next)
+	return ret, ch
 }
 
 // Update atomically updates the stored value using the current value as
@@ -132,22 +169,85 @@ func (v *Var[T]) Swap(next T) (T, <-chan struct{}) {
 // returns any other error, no action is taken and the unchanged value
 // is returned.
 func (v *Var[T]) Update(fn func(old T) (new T, _ error)) (T, <-chan struct{}, error) {
-	v.mu.Lock()
-	defer v.mu.Unlock()
+	data, _, ch, err := v.UpdateVersioned(fn)
+	return data, ch, err
+}
 
-	next, err := fn(v.mu.data)
-	if err == nil {
-		v.mu.data = next
-		v.notifyLocked()
-	} else if errors.Is(err, ErrNoUpdate) {
-		err = nil
+// currentLocked returns the current snapshot, creating it if the Var
+// is a zero value.
+func (v *Var[T]) currentLocked() *snapshot[T] {
+	if s := v.current.Load(); s != nil {
+		return s
 	}
-	return v.mu.data, v.mu.updated, err
+	s := &snapshot[T]{updated: make(chan struct{})}
+	v.current.Store(s)
+	return s
 }
 
-func (v *Var[T]) notifyLocked() {
-	if ch := v.mu.updated; ch != nil {
-		close(ch)
+// nopPublish is returned from setLocked if there are no subscribers.
+func nopPublish() {}
+
+// setLocked replaces the value and notifies any listeners, unless the
+// Var was configured to ignore equal values. It returns a
+// function that must be called once the lock has been released to
+// deliver the value to any subscribers.
+func (v *Var[T]) setLocked(next T) (publish func()) {
+	prev := v.currentLocked()
+	if v.equal != nil && v.equal(prev.data, next) {
+		return nopPublish
 	}
-	v.mu.updated = make(chan struct{})
+	v.replaceLocked(prev, &snapshot[T]{
+		data:    next,
+		updated: make(chan struct{}),
+		version: prev.version + 1,
+	})
+	if h := v.mu.history; h != nil {
+		h.add(Revision[T]{Time: time.Now(), Value: next, Version: prev.version + 1})
+	}
+	if len(v.mu.subs) == 0 {
+		return nopPublish
+	}
+
+	// Prune any subscriptions that have failed.
+	subs := v.mu.subs[:0]
+	for _, sub := range v.mu.subs {
+		if !sub.isClosed() {
+			subs = append(subs, sub)
+		}
+	}
+	clear(v.mu.subs[len(subs):])
+	v.mu.subs = subs
+
+	// Chain deliveries to ensure that values are delivered in order,
+	// without holding the lock.
+	subs = append([]*Subscription[T](nil), subs...)
+	last := v.mu.lastPublish
+	done := make(chan struct{})
+	v.mu.lastPublish = done
+	return func() {
+		defer close(done)
+		if last != nil {
+			<-last
+		}
+		for _, sub := range subs {
+			sub.deliver(next)
+		}
+	}
+}
+
+func (v *Var[T]) notifyLocked() {
+	prev := v.currentLocked()
+	v.replaceLocked(prev, &snapshot[T]{
+		data:    prev.data,
+		updated: make(chan struct{}),
+		version: prev.version,
+	})
+}
+
+// replaceLocked installs the next snapshot before closing the
+// notification channel of the previous one. This ordering guarantees
+// that a reader woken by the channel will observe the new state.
+func (v *Var[T]) replaceLocked(prev, next *snapshot[T]) {
+	v.current.Store(next)
+	close(prev.updated)
 }
@@ -18,6 +18,8 @@ package notify
 
 import (
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -141,3 +143,123 @@ func TestVarOf(t *testing.T) {
 	default:
 	}
 }
+
+// Verify that a reader woken by a notification will always observe
+// the value that triggered it.
+func TestVarReadAfterNotify(t *testing.T) {
+	r := require.New(t)
+
+	const count = 10_000
+	var v Var[int]
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= count; i++ {
+			v.Set(i)
+		}
+	}()
+
+	for last, ch := v.Get(); last < count; {
+		<-ch
+		var next int
+		next, ch = v.Get()
+		r.Greater(next, last)
+		last = next
+	}
+	wg.Wait()
+}
+
+// rwVar is a copy of the read path used by Var before it was converted
+// to atomic snapshots. It is retained to benchmark against.
+type rwVar[T any] struct {
+	mu struct {
+		sync.RWMutex
+		data    T
+		updated chan struct{}
+		version Version
+	}
+}
+
+func (v *rwVar[T]) Get() (T, <-chan struct{}) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.mu.data, v.mu.updated
+}
+
+func (v *rwVar[T]) Set(next T) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.mu.data = next
+	v.mu.version++
+	close(v.mu.updated)
+	v.mu.updated = make(chan struct{})
+}
+
+// benchVar is the subset of the Var API that is benchmarked.
+type benchVar interface {
+	Get() (int, <-chan struct{})
+	Set(int)
+}
+
+type atomicVar struct{ *Var[int] }
+
+func (v atomicVar) Set(next int) { v.Var.Set(next) }
+
+// BenchmarkVarGet compares the wait-free Var against the RWMutex
+// implementation under increasing reader concurrency. The writer
+// variants include a background goroutine that continuously replaces
+// the value.
+func BenchmarkVarGet(b *testing.B) {
+	impls := []struct {
+		name string
+		fn   func() benchVar
+	}{
+		{"atomic", func() benchVar { return atomicVar{VarOf(0)} }},
+		{"rwmutex", func() benchVar {
+			ret := &rwVar[int]{}
+			ret.mu.updated = make(chan struct{})
+			return ret
+		}},
+	}
+	for _, impl := range impls {
+		for _, writer := range []bool{false, true} {
+			for _, parallelism := range []int{1, 16, 256} {
+				name := fmt.Sprintf("%s/writer=%t/parallelism=%d", impl.name, writer, parallelism)
+				b.Run(name, func(b *testing.B) {
+					benchmarkVarGet(b, impl.fn(), writer, parallelism)
+				})
+			}
+		}
+	}
+}
+
+func benchmarkVarGet(b *testing.B, v benchVar, writer bool, parallelism int) {
+	if writer {
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+					v.Set(i)
+				}
+			}
+		}()
+		defer wg.Wait()
+		defer close(stop)
+	}
+
+	b.SetParallelism(parallelism)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			v.Get()
+		}
+	})
+}
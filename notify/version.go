@@ -0,0 +1,138 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import "errors"
+
+// A Version identifies a generation of the value held by a [Var]. The
+// version of a Var increases monotonically each time that its value is
+// replaced by Set, Swap, Update, or CompareAndSet. Calling
+// [Var.Notify] does not change the version, since the data is
+// unchanged. The zero value of a Var, or one returned from [VarOf], has
+// a version of zero.
+type Version uint64
+
+// CompareAndSet replaces the value only if the current version of the
+// Var is equal to the expected version. This allows optimistic
+// concurrency control to be implemented over a Var:
+//
+//	for {
+//	  current, version, _ := v.GetVersioned()
+//	  next := compute(current)
+//	  if _, _, ok := v.CompareAndSet(version, next); ok {
+//	    break
+//	  }
+//	}
+//
+// The version and notification channel associated with the value held
+// by the Var after the call are returned.
+func (v *Var[T]) CompareAndSet(
+	expected Version, next T,
+) (current Version, changed <-chan struct{}, ok bool) {
+	publish := nopPublish
+	v.mu.Lock()
+	if v.currentLocked().version == expected {
+		publish = v.setLocked(next)
+		ok = true
+	}
+	snap := v.currentLocked()
+	v.mu.Unlock()
+
+	publish()
+	return snap.version, snap.updated, ok
+}
+
+// GetVersioned is like [Var.Get], but also returns the version of the
+// value.
+func (v *Var[T]) GetVersioned() (T, Version, <-chan struct{}) {
+	snap := v.current.Load()
+	if snap == nil {
+		// Called on zero value, may need to initialize.
+		v.mu.Lock()
+		snap = v.currentLocked()
+		v.mu.Unlock()
+	}
+	return snap.data, snap.version, snap.updated
+}
+
+// PeekVersioned is like [Var.Peek], but also passes the version of the
+// value to the callback.
+func (v *Var[T]) PeekVersioned(fn func(value T, version Version) error) (<-chan struct{}, error) {
+	if v.current.Load() == nil {
+		// Called on zero value, may need to initialize.
+		v.mu.Lock()
+		v.currentLocked()
+		v.mu.Unlock()
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	snap := v.current.Load()
+	return snap.updated, fn(snap.data, snap.version)
+}
+
+// SetVersioned is like [Var.Set], but also returns the version of the
+// new value.
+func (v *Var[T]) SetVersioned(next T) (Version, <-chan struct{}) {
+	v.mu.Lock()
+	publish := v.setLocked(next)
+	snap := v.currentLocked()
+	v.mu.Unlock()
+
+	publish()
+	return snap.version, snap.updated
+}
+
+// SwapVersioned is like [Var.Swap], but also returns the version of the
+// new value.
+func (v *Var[T]) SwapVersioned(next T) (T, Version, <-chan struct{}) {
+	v.mu.Lock()
+	ret := v.currentLocked().data
+	publish := v.setLocked(next)
+	snap := v.currentLocked()
+	v.mu.Unlock()
+
+	publish()
+	return ret, snap.version, snap.updated
+}
+
+// UpdateVersioned is like [Var.Update], but also returns the version of
+// the value held by the Var after the call.
+func (v *Var[T]) UpdateVersioned(
+	fn func(old T) (new T, _ error),
+) (T, Version, <-chan struct{}, error) {
+	snap, _, err := v.update(fn)
+	return snap.data, snap.version, snap.updated, err
+}
+
+// update implements the various Update methods. It returns the state
+// of the Var after the call and whether the value was replaced.
+func (v *Var[T]) update(fn func(old T) (new T, _ error)) (*snapshot[T], bool, error) {
+	publish := nopPublish
+	v.mu.Lock()
+	prev := v.currentLocked()
+	next, err := fn(prev.data)
+	if err == nil {
+		publish = v.setLocked(next)
+	} else if errors.Is(err, ErrNoUpdate) {
+		err = nil
+	}
+	snap := v.currentLocked()
+	v.mu.Unlock()
+
+	publish()
+	return snap, snap.version != prev.version, err
+}
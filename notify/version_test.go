@@ -0,0 +1,125 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notify
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersion(t *testing.T) {
+	r := require.New(t)
+
+	var v Var[int]
+	value, version, ch := v.GetVersioned()
+	r.Zero(value)
+	r.Zero(version)
+	r.NotNil(ch)
+
+	version, _ = v.SetVersioned(1)
+	r.Equal(Version(1), version)
+
+	old, version, _ := v.SwapVersioned(2)
+	r.Equal(1, old)
+	r.Equal(Version(2), version)
+
+	value, version, _, err := v.UpdateVersioned(func(old int) (int, error) {
+		return old + 1, nil
+	})
+	r.NoError(err)
+	r.Equal(3, value)
+	r.Equal(Version(3), version)
+
+	// No version change if no update.
+	_, version, _, err = v.UpdateVersioned(func(int) (int, error) {
+		return 0, ErrNoUpdate
+	})
+	r.NoError(err)
+	r.Equal(Version(3), version)
+	_, version, _, err = v.UpdateVersioned(func(int) (int, error) {
+		return 0, errors.New("expected")
+	})
+	r.Error(err)
+	r.Equal(Version(3), version)
+
+	// Notify replaces the channel, but not the version.
+	_, _, ch = v.GetVersioned()
+	v.Notify()
+	_, version, ch2 := v.GetVersioned()
+	r.Equal(Version(3), version)
+	r.NotEqual(ch, ch2)
+
+	_, err = v.PeekVersioned(func(value int, version Version) error {
+		r.Equal(3, value)
+		r.Equal(Version(3), version)
+		return nil
+	})
+	r.NoError(err)
+
+	// The non-versioned methods also advance the version.
+	v.Set(4)
+	_, version, _ = v.GetVersioned()
+	r.Equal(Version(4), version)
+}
+
+func TestCompareAndSet(t *testing.T) {
+	r := require.New(t)
+
+	v := VarOf(0)
+	version, ch, ok := v.CompareAndSet(0, 1)
+	r.True(ok)
+	r.Equal(Version(1), version)
+	select {
+	case <-ch:
+		r.Fail("channel should be open")
+	default:
+	}
+
+	// Stale version is rejected.
+	version, ch2, ok := v.CompareAndSet(0, 2)
+	r.False(ok)
+	r.Equal(Version(1), version)
+	r.Equal(ch, ch2)
+	current, _ := v.Get()
+	r.Equal(1, current)
+
+	// Optimistic increments from many goroutines.
+	const workers = 16
+	const increments = 100
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				for {
+					current, version, _ := v.GetVersioned()
+					if _, _, ok := v.CompareAndSet(version, current+1); ok {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	current, version, _ = v.GetVersioned()
+	r.Equal(1+workers*increments, current)
+	r.Equal(Version(1+workers*increments), version)
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrCleanupBudgetExceeded is returned from [Context.Wait] if the
+// callbacks registered with [Context.DeferCleanup] did not complete
+// within the duration set by [CleanupBudget].
+var ErrCleanupBudgetExceeded = errors.New("cleanup budget exceeded")
+
+// CleanupBudget limits the total amount of time that may be spent
+// executing callbacks registered with [Context.Defer] or
+// [Context.DeferCleanup]. The context passed to the callbacks will be
+// canceled once the budget has been exhausted. If the callbacks have
+// not returned by that time, [Context.Wait] will stop waiting for them
+// and return [ErrCleanupBudgetExceeded].
+func CleanupBudget(d time.Duration) Option {
+	return func(o *options) { o.cleanupBudget = d }
+}
+
+// DeferCleanup registers a callback that will be executed after the
+// [Context.Done] channel is closed. It is similar to [Context.Defer],
+// except that the callback receives a context that is bounded by the
+// [CleanupBudget] option and may return an error. Errors will be
+// returned from [Context.Wait]. The context passed to the callback
+// retains the values of the Context, but not its cancellation.
+//
+// Callbacks are executed in a LIFO manner, without holding any locks
+// on the Context, by the goroutine that causes the Context to be
+// canceled. If the callbacks are being executed when this method is
+// called, the callback will be executed after the callbacks that are
+// still pending. If the Context has already stopped, the callback
+// will be executed immediately.
+//
+// Calling this method on the Background context will panic, since that
+// context can never be cancelled.
+func (c *Context) DeferCleanup(fn func(ctx context.Context) error) {
+	if c == background {
+		panic(errors.New("cannot call Context.Defer() on a background context"))
+	}
+	c.mu.Lock()
+	if c.Err() == nil || c.mu.cleaning {
+		c.mu.deferred = append(c.mu.deferred, fn)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := c.cleanupContext()
+	defer cancel()
+	c.runCleanup(ctx, fn)
+}
+
+// cleanup executes the deferred callbacks and then closes the cleaned
+// channel. If a CleanupBudget has been set, the callbacks are executed
+// in a separate goroutine, so that this method may return once the
+// budget has been exhausted.
+func (c *Context) cleanup() {
+	c.mu.RLock()
+	cleaned := c.mu.cleaned
+	c.mu.RUnlock()
+	defer close(cleaned)
+
+	ctx, cancel := c.cleanupContext()
+	defer cancel()
+
+	if c.opts.cleanupBudget <= 0 {
+		c.runDeferred(ctx)
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.runDeferred(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// Give up waiting for slow callbacks, unless they just
+		// finished.
+		select {
+		case <-done:
+		default:
+			c.mu.Lock()
+			c.mu.cleanupErrs = append(c.mu.cleanupErrs, ErrCleanupBudgetExceeded)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// runDeferred executes the deferred callbacks in LIFO order, until
+// none remain.
+func (c *Context) runDeferred(ctx context.Context) {
+	for {
+		c.mu.Lock()
+		idx := len(c.mu.deferred) - 1
+		if idx < 0 {
+			c.mu.cleaning = false
+			c.mu.Unlock()
+			return
+		}
+		fn := c.mu.deferred[idx]
+		c.mu.deferred = c.mu.deferred[:idx]
+		c.mu.Unlock()
+
+		c.runCleanup(ctx, fn)
+	}
+}
+
+// cleanupContext returns the context to pass to deferred callbacks.
+func (c *Context) cleanupContext() (context.Context, context.CancelFunc) {
+	ctx := context.WithoutCancel(c.delegate)
+	if c.opts.cleanupBudget > 0 {
+		return context.WithTimeout(ctx, c.opts.cleanupBudget)
+	}
+	return context.WithCancel(ctx)
+}
+
+// runCleanup executes a single deferred callback.
+func (c *Context) runCleanup(ctx context.Context, fn func(ctx context.Context) error) {
+	if err := fn(ctx); err != nil {
+		c.mu.Lock()
+		c.mu.cleanupErrs = append(c.mu.cleanupErrs, err)
+		c.mu.Unlock()
+	}
+	if obs := c.opts.observer; obs != nil {
+		obs.DeferredRun(c)
+	}
+}
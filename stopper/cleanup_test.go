@@ -0,0 +1,148 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type cleanupKey struct{}
+
+func TestDeferCleanup(t *testing.T) {
+	r := require.New(t)
+
+	top := context.WithValue(context.Background(), cleanupKey{}, "value")
+	s := WithContext(top)
+	errA := errors.New("a")
+	errB := errors.New("b")
+	var order []string
+	s.DeferCleanup(func(ctx context.Context) error {
+		order = append(order, "a")
+		return errA
+	})
+	s.DeferCleanup(func(ctx context.Context) error {
+		order = append(order, "b")
+		// Values are retained, but not the cancellation.
+		r.Equal("value", ctx.Value(cleanupKey{}))
+		r.NoError(ctx.Err())
+		_, hasDeadline := ctx.Deadline()
+		r.False(hasDeadline)
+		// The lock is not held, so we can call into the Context.
+		r.Zero(s.Len())
+		r.True(s.IsStopping())
+		return errB
+	})
+
+	taskErr := errors.New("task")
+	r.True(s.Go(func(*Context) error { return taskErr }))
+
+	err := s.Wait()
+	r.Equal([]string{"b", "a"}, order)
+	r.ErrorIs(err, taskErr)
+	r.ErrorIs(err, errA)
+	r.ErrorIs(err, errB)
+
+	// Immediate execution also records the error.
+	errC := errors.New("c")
+	s.DeferCleanup(func(context.Context) error { return errC })
+	r.ErrorIs(s.Wait(), errC)
+}
+
+func TestCleanupBudget(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background(), CleanupBudget(10*time.Millisecond))
+	release := make(chan struct{})
+	defer close(release)
+
+	sawDeadline := make(chan struct{})
+	s.DeferCleanup(func(ctx context.Context) error {
+		<-ctx.Done()
+		close(sawDeadline)
+		// Ignore the deadline.
+		<-release
+		return nil
+	})
+	s.Stop(0)
+
+	r.ErrorIs(s.Wait(), ErrCleanupBudgetExceeded)
+	select {
+	case <-sawDeadline:
+	case <-time.After(time.Second):
+		r.Fail("callback did not see deadline")
+	}
+}
+
+func TestCleanupBudgetNotExceeded(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background(), CleanupBudget(time.Hour))
+	s.DeferCleanup(func(ctx context.Context) error {
+		_, hasDeadline := ctx.Deadline()
+		r.True(hasDeadline)
+		return nil
+	})
+	s.Stop(0)
+	r.NoError(s.Wait())
+}
+
+func TestDeferSynchronous(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	var ran bool
+	s.Defer(func() { ran = true })
+	s.Stop(0)
+	<-s.Done()
+	r.True(ran)
+}
+
+func TestDeferDuringCleanup(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	var order []string
+	s.Defer(func() { order = append(order, "a") })
+
+	running := make(chan struct{})
+	release := make(chan struct{})
+	s.Defer(func() {
+		close(running)
+		<-release
+		order = append(order, "b")
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		s.Stop(0)
+	}()
+	<-running
+
+	// The callback is not run concurrently with the one in flight, but
+	// is run before the remaining callbacks.
+	s.Defer(func() { order = append(order, "c") })
+	close(release)
+	<-stopped
+	r.Equal([]string{"b", "c", "a"}, order)
+	r.NoError(s.Wait())
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// DumpStacks enables the collection of goroutine stacks for all tasks
+// that are still running when the grace period passed to
+// [Context.Stop] expires. The resulting [GracePeriodError] will be
+// returned from [context.Cause] and passed to the optional sink
+// (e.g. to log it) once the Context has been canceled.
+//
+// Enabling this option adds a small amount of overhead to each call to
+// [Context.Go] or [Context.Call].
+func DumpStacks(sink func(err *GracePeriodError)) Option {
+	return func(o *options) {
+		o.dumpStacks = true
+		o.stackSink = sink
+	}
+}
+
+// TaskStack associates a task with the stack of its goroutine.
+type TaskStack struct {
+	TaskInfo
+	Stack string // Empty if the goroutine could not be located.
+}
+
+// A GracePeriodError is returned from [context.Cause] when the grace
+// period of a Context created with [DumpStacks] has expired. It
+// describes the tasks which had not exited in time. A
+// GracePeriodError will match [ErrGracePeriodExpired] when used with
+// [errors.Is].
+type GracePeriodError struct {
+	Tasks []TaskStack
+}
+
+// Error implements error.
+func (e *GracePeriodError) Error() string {
+	labels := make([]string, len(e.Tasks))
+	for i, t := range e.Tasks {
+		labels[i] = t.Label
+		if labels[i] == "" {
+			labels[i] = "<unlabeled>"
+		}
+	}
+	return fmt.Sprintf("%s: %d task(s) still running: %s",
+		ErrGracePeriodExpired, len(e.Tasks), strings.Join(labels, ", "))
+}
+
+// Report returns a multi-line description of the tasks, including
+// their goroutine stacks.
+func (e *GracePeriodError) Report() string {
+	var sb strings.Builder
+	sb.WriteString(e.Error())
+	for _, t := range e.Tasks {
+		fmt.Fprintf(&sb, "\n\ntask %q started at %s\n%s",
+			t.Label, t.Started.Format("2006-01-02T15:04:05.000Z07:00"), t.Stack)
+	}
+	return sb.String()
+}
+
+// Unwrap returns [ErrGracePeriodExpired].
+func (e *GracePeriodError) Unwrap() error { return ErrGracePeriodExpired }
+
+// captureID records the current goroutine's id in the task if stack
+// dumps have been requested.
+func (c *Context) captureID(t *task) {
+	if c.opts.dumpStacks {
+		t.goid.Store(goroutineID())
+	}
+}
+
+// expireGracePeriod cancels the Context when the grace period passed to
+// Stop has elapsed.
+func (c *Context) expireGracePeriod() {
+	var cause error = ErrGracePeriodExpired
+	var report *GracePeriodError
+	if c.opts.dumpStacks {
+		report = c.stackReport()
+		cause = report
+	}
+
+	c.mu.Lock()
+	if c.Err() != nil {
+		// Raced with a clean exit.
+		c.mu.Unlock()
+		return
+	}
+	cleanup := c.cancelLocked(cause)
+	c.mu.Unlock()
+
+	if obs := c.opts.observer; obs != nil {
+		obs.GracePeriodExpired(c)
+	}
+	if cleanup != nil {
+		cleanup()
+	}
+
+	if report != nil && c.opts.stackSink != nil {
+		c.opts.stackSink(report)
+	}
+}
+
+// stackReport collects the stacks of all tasks in the Context and its
+// children.
+func (c *Context) stackReport() *GracePeriodError {
+	stacks := allStacks()
+	ret := &GracePeriodError{}
+	c.walk(func(t *task) {
+		ret.Tasks = append(ret.Tasks, TaskStack{
+			TaskInfo: t.info(),
+			Stack:    stacks[t.goid.Load()],
+		})
+	})
+	return ret
+}
+
+// walk invokes the callback for each task in the Context and its
+// children.
+func (c *Context) walk(fn func(t *task)) {
+	c.mu.RLock()
+	tasks := make([]*task, 0, len(c.mu.tasks))
+	for t := range c.mu.tasks {
+		tasks = append(tasks, t)
+	}
+	children := make([]*Context, 0, len(c.mu.children))
+	for child := range c.mu.children {
+		children = append(children, child)
+	}
+	c.mu.RUnlock()
+
+	for _, t := range tasks {
+		fn(t)
+	}
+	for _, child := range children {
+		child.walk(fn)
+	}
+}
+
+// allStacks returns the stacks of all goroutines, keyed by id.
+func allStacks() map[uint64]string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	ret := make(map[uint64]string)
+	for _, stanza := range bytes.Split(buf, []byte("\n\n")) {
+		if id, ok := parseGoroutineID(stanza); ok {
+			ret[id] = string(stanza)
+		}
+	}
+	return ret
+}
+
+// goroutineID returns the id of the current goroutine.
+func goroutineID() uint64 {
+	var buf [64]byte
+	id, _ := parseGoroutineID(buf[:runtime.Stack(buf[:], false)])
+	return id
+}
+
+// parseGoroutineID extracts the id from a stack header of the form
+// "goroutine 123 [running]:".
+func parseGoroutineID(stack []byte) (uint64, bool) {
+	stack, ok := bytes.CutPrefix(stack, []byte("goroutine "))
+	if !ok {
+		return 0, false
+	}
+	idx := bytes.IndexByte(stack, ' ')
+	if idx < 0 {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(string(stack[:idx]), 10, 64)
+	return id, err == nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func stuckTask(ctx *Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestDumpStacks(t *testing.T) {
+	r := require.New(t)
+
+	reported := make(chan *GracePeriodError, 1)
+	parent := WithContext(context.Background(), DumpStacks(func(err *GracePeriodError) {
+		reported <- err
+	}))
+	child := WithContext(parent)
+
+	r.True(parent.Go(stuckTask, TaskLabel("outer")))
+	r.True(child.Go(stuckTask, TaskLabel("inner")))
+	r.True(parent.Go(func(ctx *Context) error {
+		<-ctx.Stopping()
+		return nil
+	}, TaskLabel("well-behaved")))
+
+	parent.Stop(10 * time.Millisecond)
+	r.NoError(parent.Wait())
+
+	var report *GracePeriodError
+	select {
+	case report = <-reported:
+	case <-time.After(time.Second):
+		r.Fail("timed out waiting for report")
+	}
+
+	cause := context.Cause(parent)
+	r.ErrorIs(cause, ErrGracePeriodExpired)
+	r.True(errors.As(cause, &report))
+	r.Len(report.Tasks, 2)
+	r.ElementsMatch([]string{"outer", "inner"},
+		[]string{report.Tasks[0].Label, report.Tasks[1].Label})
+	for _, task := range report.Tasks {
+		r.Contains(task.Stack, "stuckTask")
+	}
+	r.Contains(report.Error(), "2 task(s) still running")
+	r.Contains(report.Report(), "stuckTask")
+
+	// The child inherits the cause from the parent.
+	r.ErrorIs(context.Cause(child), ErrGracePeriodExpired)
+}
+
+func TestDumpStacksNilSink(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background(), DumpStacks(nil))
+	r.True(s.Go(stuckTask))
+	s.Stop(10 * time.Millisecond)
+	<-s.Done()
+
+	var report *GracePeriodError
+	r.ErrorAs(context.Cause(s), &report)
+	r.Len(report.Tasks, 1)
+	r.Contains(report.Tasks[0].Stack, "stuckTask")
+}
+
+func TestParseGoroutineID(t *testing.T) {
+	r := require.New(t)
+
+	id, ok := parseGoroutineID([]byte("goroutine 123 [running]:\nmain.main()"))
+	r.True(ok)
+	r.Equal(uint64(123), id)
+
+	_, ok = parseGoroutineID([]byte("garbage"))
+	r.False(ok)
+
+	r.NotZero(goroutineID())
+}
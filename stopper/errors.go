@@ -0,0 +1,68 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+// CollectErrors causes the Context to retain every error returned by
+// functions passed to [Context.Go], rather than only the first. The
+// errors will be returned from [Context.Wait] in a form compatible with
+// [errors.Join] and are available from [Context.Errors].
+func CollectErrors() Option {
+	return func(o *options) { o.collectErrors = true }
+}
+
+// A TaskError associates an error with the label of the task that
+// returned it.
+type TaskError struct {
+	Label string // The value passed to TaskLabel, if any.
+	Err   error
+}
+
+// Error implements error.
+func (e TaskError) Error() string {
+	if e.Label == "" {
+		return e.Err.Error()
+	}
+	return e.Label + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e TaskError) Unwrap() error { return e.Err }
+
+// Errors returns the errors that have been returned by functions passed
+// to [Context.Go], in the order in which they were received. Unless the
+// Context was constructed with [CollectErrors], this will contain at
+// most one element.
+func (c *Context) Errors() []TaskError {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.mu.errs) == 0 {
+		return nil
+	}
+	ret := make([]TaskError, len(c.mu.errs))
+	copy(ret, c.mu.errs)
+	return ret
+}
+
+// recordError retains an error returned from a task.
+func (c *Context) recordError(t *task, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.mu.errs) > 0 && !c.opts.collectErrors {
+		return
+	}
+	c.mu.errs = append(c.mu.errs, TaskError{Label: t.label, Err: err})
+}
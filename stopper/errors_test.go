@@ -0,0 +1,72 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectErrors(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background(), CollectErrors())
+	errA := errors.New("a")
+	errB := errors.New("b")
+
+	// Ensure that both tasks are running before either fails.
+	ready := make(chan struct{})
+	r.True(s.Go(func(*Context) error { <-ready; return errA }, TaskLabel("task-a")))
+	r.True(s.Go(func(*Context) error { <-ready; return errB }, TaskLabel("task-b")))
+	r.True(s.Go(func(*Context) error { <-ready; return nil }, TaskLabel("task-c")))
+	close(ready)
+
+	err := s.Wait()
+	r.ErrorIs(err, errA)
+	r.ErrorIs(err, errB)
+
+	errs := s.Errors()
+	r.Len(errs, 2)
+	r.ElementsMatch([]string{"task-a: a", "task-b: b"},
+		[]string{errs[0].Error(), errs[1].Error()})
+	r.ErrorIs(errs[0], errs[0].Err)
+}
+
+func TestFirstErrorOnly(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	errA := errors.New("a")
+	errB := errors.New("b")
+
+	ready := make(chan struct{})
+	r.True(s.Go(func(*Context) error { <-ready; return errA }))
+	r.True(s.Go(func(*Context) error { <-ready; return errB }))
+	close(ready)
+
+	err := s.Wait()
+	r.Error(err)
+	r.False(errors.Is(err, errA) && errors.Is(err, errB))
+
+	errs := s.Errors()
+	r.Len(errs, 1)
+	r.Same(err, errs[0].Err)
+	r.Equal(err.Error(), errs[0].Error())
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"expvar"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// unlabeled is the metric key used for tasks without a label.
+const unlabeled = "unlabeled"
+
+// Metrics is an [Observer] that maintains counters and gauges which
+// are compatible with the expvar package. Task metrics are keyed by
+// the label passed to [TaskLabel], which allows activity to be
+// attributed to different subsystems. The zero value is ready to use.
+//
+// Metrics implements [expvar.Var], so it may be published directly:
+//
+//	m := &stopper.Metrics{}
+//	expvar.Publish("stopper", m)
+//	ctx := stopper.WithContext(context.Background(), stopper.Observe(m))
+type Metrics struct {
+	Deferred     expvar.Int   // Number of deferred callbacks executed.
+	Failed       expvar.Map   // Tasks which returned an error, by label.
+	Finished     expvar.Map   // Tasks which have returned, by label.
+	GraceExpired expvar.Int   // Number of grace-period expirations.
+	Running      expvar.Map   // Gauge of running tasks, by label.
+	Started      expvar.Map   // Tasks which have started, by label.
+	Stops        expvar.Int   // Number of Contexts that were stopped.
+	TaskSeconds  expvar.Float // Cumulative task execution time.
+}
+
+var (
+	_ Observer   = (*Metrics)(nil)
+	_ expvar.Var = (*Metrics)(nil)
+)
+
+// DeferredRun implements [Observer].
+func (m *Metrics) DeferredRun(*Context) { m.Deferred.Add(1) }
+
+// GracePeriodExpired implements [Observer].
+func (m *Metrics) GracePeriodExpired(*Context) { m.GraceExpired.Add(1) }
+
+// StopRequested implements [Observer].
+func (m *Metrics) StopRequested(*Context, time.Duration) { m.Stops.Add(1) }
+
+// String implements [expvar.Var] and returns a JSON object.
+func (m *Metrics) String() string {
+	vars := []struct {
+		name string
+		v    expvar.Var
+	}{
+		{"deferred", &m.Deferred},
+		{"failed", &m.Failed},
+		{"finished", &m.Finished},
+		{"grace_expired", &m.GraceExpired},
+		{"running", &m.Running},
+		{"started", &m.Started},
+		{"stops", &m.Stops},
+		{"task_seconds", &m.TaskSeconds},
+	}
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i, v := range vars {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%q: %s", v.name, v.v.String())
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// TaskFinished implements [Observer].
+func (m *Metrics) TaskFinished(_ *Context, task TaskInfo, elapsed time.Duration, err error) {
+	key := metricKey(task)
+	m.Running.Add(key, -1)
+	m.Finished.Add(key, 1)
+	if err != nil {
+		m.Failed.Add(key, 1)
+	}
+	m.TaskSeconds.Add(elapsed.Seconds())
+}
+
+// TaskStarted implements [Observer].
+func (m *Metrics) TaskStarted(_ *Context, task TaskInfo) {
+	key := metricKey(task)
+	m.Running.Add(key, 1)
+	m.Started.Add(key, 1)
+}
+
+func metricKey(task TaskInfo) string {
+	if task.Label == "" {
+		return unlabeled
+	}
+	return task.Label
+}
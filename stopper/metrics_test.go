@@ -0,0 +1,64 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	r := require.New(t)
+
+	m := &Metrics{}
+	s := WithContext(context.Background(), Observe(m))
+	s.Defer(func() {})
+
+	r.NoError(s.Call(func(*Context) error {
+		r.Equal("1", m.Running.Get("sub").String())
+		return nil
+	}, TaskLabel("sub")))
+	r.Error(s.Call(func(*Context) error { return errors.New("BOOM") }))
+
+	r.True(s.Go(func(ctx *Context) error { <-ctx.Stopping(); return nil }, TaskLabel("sub")))
+	s.Stop(0)
+	r.NoError(s.Wait())
+
+	var decoded struct {
+		Deferred     int
+		Failed       map[string]int
+		Finished     map[string]int
+		GraceExpired int `json:"grace_expired"`
+		Running      map[string]int
+		Started      map[string]int
+		Stops        int
+		TaskSeconds  float64 `json:"task_seconds"`
+	}
+	r.NoError(json.Unmarshal([]byte(m.String()), &decoded))
+	r.Equal(1, decoded.Deferred)
+	r.Equal(map[string]int{"unlabeled": 1}, decoded.Failed)
+	r.Equal(map[string]int{"sub": 2, "unlabeled": 1}, decoded.Finished)
+	r.Zero(decoded.GraceExpired)
+	r.Equal(map[string]int{"sub": 0, "unlabeled": 0}, decoded.Running)
+	r.Equal(map[string]int{"sub": 2, "unlabeled": 1}, decoded.Started)
+	r.Equal(1, decoded.Stops)
+	r.GreaterOrEqual(decoded.TaskSeconds, 0.0)
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import "time"
+
+// An Observer receives notifications about lifecycle transitions in a
+// Context. Observer methods are called synchronously and should return
+// quickly. Embed [NopObserver] to implement only a subset of the
+// methods.
+type Observer interface {
+	// TaskStarted is called when a task has been accepted by
+	// [Context.Go] or [Context.Call].
+	TaskStarted(ctx *Context, task TaskInfo)
+	// TaskFinished is called when a task has returned.
+	TaskFinished(ctx *Context, task TaskInfo, elapsed time.Duration, err error)
+	// StopRequested is called the first time that [Context.Stop] is
+	// called.
+	StopRequested(ctx *Context, gracePeriod time.Duration)
+	// GracePeriodExpired is called when a Context has been canceled
+	// because its tasks did not exit within the grace period.
+	GracePeriodExpired(ctx *Context)
+	// DeferredRun is called after each callback registered with
+	// [Context.Defer] or [Context.DeferCleanup] has been executed.
+	DeferredRun(ctx *Context)
+}
+
+// Observe registers an Observer with the Context. Since options are
+// inherited, the Observer will also be notified of transitions in
+// Contexts derived from the one being constructed.
+func Observe(obs Observer) Option {
+	return func(o *options) { o.observer = obs }
+}
+
+// NopObserver implements [Observer] with no-op methods.
+type NopObserver struct{}
+
+var _ Observer = NopObserver{}
+
+// TaskStarted implements [Observer].
+func (NopObserver) TaskStarted(*Context, TaskInfo) {}
+
+// TaskFinished implements [Observer].
+func (NopObserver) TaskFinished(*Context, TaskInfo, time.Duration, error) {}
+
+// StopRequested implements [Observer].
+func (NopObserver) StopRequested(*Context, time.Duration) {}
+
+// GracePeriodExpired implements [Observer].
+func (NopObserver) GracePeriodExpired(*Context) {}
+
+// DeferredRun implements [Observer].
+func (NopObserver) DeferredRun(*Context) {}
@@ -0,0 +1,115 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingObserver struct {
+	NopObserver
+	mu     sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) record(format string, args ...any) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, fmt.Sprintf(format, args...))
+}
+
+func (o *recordingObserver) Events() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.events...)
+}
+
+func (o *recordingObserver) TaskStarted(_ *Context, task TaskInfo) {
+	o.record("started %s", task.Label)
+}
+
+func (o *recordingObserver) TaskFinished(_ *Context, task TaskInfo, _ time.Duration, err error) {
+	o.record("finished %s %v", task.Label, err)
+}
+
+func (o *recordingObserver) StopRequested(*Context, time.Duration) {
+	o.record("stop")
+}
+
+func (o *recordingObserver) GracePeriodExpired(*Context) {
+	o.record("expired")
+}
+
+func (o *recordingObserver) DeferredRun(*Context) {
+	o.record("deferred")
+}
+
+func TestObserver(t *testing.T) {
+	r := require.New(t)
+
+	obs := &recordingObserver{}
+	s := WithContext(context.Background(), Observe(obs))
+	s.Defer(func() {})
+
+	r.NoError(s.Call(func(*Context) error { return nil }, TaskLabel("call")))
+	r.True(s.Go(func(*Context) error { return errors.New("BOOM") }, TaskLabel("go")))
+	r.ErrorContains(s.Wait(), "BOOM")
+
+	r.Equal([]string{
+		"started call",
+		"finished call <nil>",
+		"started go",
+		"stop",
+		"finished go BOOM",
+		"deferred",
+	}, obs.Events())
+
+	// An idle Context reports the stop before running callbacks.
+	obs = &recordingObserver{}
+	s = WithContext(context.Background(), Observe(obs))
+	s.Defer(func() {})
+	s.Stop(0)
+	<-s.Done()
+	r.Equal([]string{"stop", "deferred"}, obs.Events())
+}
+
+func TestObserverChildAndGrace(t *testing.T) {
+	r := require.New(t)
+
+	obs := &recordingObserver{}
+	parent := WithContext(context.Background(), Observe(obs))
+	child := WithContext(parent)
+	r.True(child.Go(stuckTask, TaskLabel("stuck")))
+
+	parent.Stop(time.Millisecond)
+	r.NoError(parent.Wait())
+
+	r.Eventually(func() bool {
+		return len(obs.Events()) == 5
+	}, time.Second, time.Millisecond)
+	events := obs.Events()
+	r.Equal("started stuck", events[0])
+	r.Equal("stop", events[1])
+	r.ElementsMatch([]string{"expired", "stop", "finished stuck <nil>"}, events[2:])
+}
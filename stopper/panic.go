@@ -0,0 +1,72 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// RecoverPanics causes a panic in a function passed to [Context.Go] to
+// be converted into a [*PanicError]. The error is handled like any
+// other error returned from the function: the Context will be stopped
+// and the error will be returned from [Context.Wait]. This allows
+// functions registered with [Context.Defer] to run, rather than
+// crashing the process.
+func RecoverPanics() Option {
+	return func(o *options) { o.recoverPanics = true }
+}
+
+// A PanicError is produced when a function passed to [Context.Go] or
+// [Context.Call] panics and the Context was constructed with
+// [RecoverPanics].
+type PanicError struct {
+	Label string // The value passed to TaskLabel, if any.
+	Stack []byte // The stack of the panicking goroutine.
+	Value any    // The value passed to panic().
+}
+
+// Error implements error.
+func (e *PanicError) Error() string {
+	if e.Label == "" {
+		return fmt.Sprintf("panic: %v", e.Value)
+	}
+	return fmt.Sprintf("panic in %s: %v", e.Label, e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// invoke executes the task's function, possibly recovering panics.
+func (c *Context) invoke(t *task, fn func(ctx *Context) error) (err error) {
+	if t.timeout > 0 {
+		return c.invokeWithTimeout(t, fn)
+	}
+	if c.opts.recoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Label: t.label, Stack: debug.Stack(), Value: r}
+			}
+		}()
+	}
+	return fn(c)
+}
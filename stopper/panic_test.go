@@ -0,0 +1,73 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func panicky(*Context) error {
+	panic("BOOM")
+}
+
+func TestRecoverPanics(t *testing.T) {
+	r := require.New(t)
+
+	var deferred atomic.Bool
+	s := WithContext(context.Background(), RecoverPanics())
+	s.Defer(func() { deferred.Store(true) })
+
+	r.True(s.Go(panicky, TaskLabel("panicky")))
+
+	err := s.Wait()
+	var panicErr *PanicError
+	r.ErrorAs(err, &panicErr)
+	r.Equal("BOOM", panicErr.Value)
+	r.Equal("panic in panicky: BOOM", panicErr.Error())
+	r.Contains(string(panicErr.Stack), "panicky")
+	r.NoError(panicErr.Unwrap())
+	r.True(s.IsStopping())
+	r.True(deferred.Load())
+}
+
+func TestRecoverPanicsCall(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background(), RecoverPanics())
+	boom := errors.New("BOOM")
+	err := s.Call(func(*Context) error { panic(boom) })
+	r.ErrorIs(err, boom)
+	r.Equal("panic: BOOM", err.Error())
+
+	// Consistent with Call, the Context is not stopped.
+	r.False(s.IsStopping())
+	r.Zero(s.Len())
+}
+
+func TestRecoverPanicsInherited(t *testing.T) {
+	r := require.New(t)
+
+	parent := WithContext(context.Background(), RecoverPanics())
+	child := WithContext(parent)
+	r.True(child.Go(panicky))
+	r.ErrorAs(child.Wait(), new(*PanicError))
+}
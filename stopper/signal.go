@@ -0,0 +1,140 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrSignaled will be returned from [context.Cause] when a Context has
+// been forcefully canceled by a repeated signal. See [StopOnSignal].
+var ErrSignaled = errors.New("canceled by repeated signal")
+
+// SignalConfig controls the behavior of [StopOnSignal].
+type SignalConfig struct {
+	// The grace period to pass to [Context.Stop] when the first signal
+	// is received.
+	GracePeriod time.Duration
+	// HardExit is invoked when a third signal is received. If nil,
+	// os.Exit(1) will be called.
+	HardExit func()
+	// The signals to listen for. If empty, [os.Interrupt] and
+	// [syscall.SIGTERM] will be used.
+	Signals []os.Signal
+}
+
+// StopOnSignal provides process-level shutdown behavior by escalating
+// the response to repeated OS signals:
+//   - The first signal calls [Context.Stop] with the configured grace
+//     period. Well-behaved tasks will observe the [Context.Stopping]
+//     channel and exit.
+//   - The second signal cancels the Context immediately, closing the
+//     [Context.Done] channel. The cause will be [ErrSignaled].
+//   - The third signal invokes the configured HardExit function.
+//
+// Signal handling continues until the returned function is called or
+// until the Context has stopped and all callbacks registered with
+// [Context.Defer] have been executed, as reported by [Context.Wait].
+// That is, repeated signals will be handled while deferred cleanup is
+// in progress.
+//
+// Calling this function with the Background context will panic.
+func StopOnSignal(ctx *Context, cfg *SignalConfig) (release func()) {
+	if ctx == background {
+		panic(errors.New("cannot call StopOnSignal() on a background context"))
+	}
+	signals := cfg.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+
+	done := make(chan struct{})
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+	// Release once the deferred callbacks have been executed. This
+	// does not use Defer, since callbacks registered before this
+	// function was called would be executed afterward.
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = ctx.Wait()
+			release()
+		case <-done:
+		}
+	}()
+
+	go handleSignals(ctx, cfg, ch, done)
+	return release
+}
+
+// handleSignals implements StopOnSignal.
+func handleSignals(ctx *Context, cfg *SignalConfig, ch <-chan os.Signal, done <-chan struct{}) {
+	hardExit := cfg.HardExit
+	if hardExit == nil {
+		hardExit = func() { os.Exit(1) }
+	}
+	for count := 0; ; {
+		select {
+		case <-ch:
+			count++
+		case <-done:
+			return
+		}
+		switch count {
+		case 1:
+			// Deferred callbacks may be executed by Stop, so we don't
+			// want to block here.
+			go ctx.Stop(cfg.GracePeriod)
+		case 2:
+			// Deferred callbacks will be executed by the cancellation,
+			// so we don't want to block here.
+			go ctx.forceCancel(ErrSignaled)
+		default:
+			hardExit()
+		}
+	}
+}
+
+// forceCancel immediately cancels the Context, without waiting for
+// tasks to exit.
+func (c *Context) forceCancel(cause error) {
+	var cleanup func()
+	c.mu.Lock()
+	if !c.mu.stopping {
+		c.mu.stopping = true
+		close(c.stopping)
+	}
+	if c.Err() == nil {
+		cleanup = c.cancelLocked(cause)
+	}
+	c.mu.Unlock()
+	if cleanup != nil {
+		cleanup()
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleSignals(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	r.True(s.Go(stuckTask))
+
+	exited := make(chan struct{})
+	cfg := &SignalConfig{
+		GracePeriod: time.Hour,
+		HardExit:    func() { close(exited) },
+	}
+	ch := make(chan os.Signal)
+	done := make(chan struct{})
+	defer close(done)
+	go handleSignals(s, cfg, ch, done)
+
+	// First signal is a soft stop.
+	ch <- syscall.SIGTERM
+	select {
+	case <-s.Stopping():
+	case <-time.After(time.Second):
+		r.Fail("timed out waiting for Stopping")
+	}
+	r.NoError(s.Err())
+
+	// Second signal cancels, even though the task hasn't exited.
+	ch <- syscall.SIGTERM
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		r.Fail("timed out waiting for Done")
+	}
+	r.ErrorIs(context.Cause(s), ErrSignaled)
+
+	// Third signal exits.
+	ch <- syscall.SIGTERM
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		r.Fail("timed out waiting for hard exit")
+	}
+	r.NoError(s.Wait())
+}
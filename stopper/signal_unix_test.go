@@ -0,0 +1,92 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unix
+
+package stopper
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopOnSignal(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	release := StopOnSignal(s, &SignalConfig{Signals: []os.Signal{syscall.SIGUSR1}})
+
+	r.NoError(syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		r.Fail("timed out waiting for Done")
+	}
+	r.ErrorIs(context.Cause(s), ErrStopped)
+
+	// Also called once cleanup has finished, so this is idempotent.
+	release()
+}
+
+func TestStopOnSignalDuringCleanup(t *testing.T) {
+	r := require.New(t)
+
+	// Prevent the process from exiting if the handler is released
+	// too early.
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGUSR2)
+	defer signal.Stop(guard)
+
+	s := WithContext(context.Background())
+	exited := make(chan struct{})
+	var once sync.Once
+
+	// This callback is registered first, so it runs last.
+	handled := make(chan bool, 1)
+	s.Defer(func() {
+		deadline := time.After(5 * time.Second)
+		for {
+			if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+				handled <- false
+				return
+			}
+			select {
+			case <-exited:
+				handled <- true
+				return
+			case <-deadline:
+				handled <- false
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	})
+	StopOnSignal(s, &SignalConfig{
+		HardExit: func() { once.Do(func() { close(exited) }) },
+		Signals:  []os.Signal{syscall.SIGUSR2},
+	})
+
+	r.NoError(syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+	r.NoError(s.Wait())
+	r.True(<-handled)
+}
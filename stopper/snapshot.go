@@ -0,0 +1,164 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// A TaskOption customizes a task started by [Context.Go] or
+// [Context.Call].
+type TaskOption func(t *task)
+
+// TaskLabel associates a human-readable label with a task. The label
+// will be reported by [Context.Snapshot].
+func TaskLabel(label string) TaskOption {
+	return func(t *task) { t.label = label }
+}
+
+// task holds the state associated with a single call to Go or Call.
+type task struct {
+	goid         atomic.Uint64 // Set if stack dumps are enabled.
+	label        string
+	started      time.Time
+	timeout      time.Duration // Set by TaskTimeout.
+	timeoutGrace time.Duration // Set by TaskTimeout.
+}
+
+// info returns the public description of the task.
+func (t *task) info() TaskInfo {
+	return TaskInfo{Label: t.label, Started: t.started}
+}
+
+func newTask(opts []TaskOption) *task {
+	t := &task{started: time.Now()}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// TaskInfo describes a task that is being tracked by a Context.
+type TaskInfo struct {
+	Label   string    // The value passed to TaskLabel, if any.
+	Started time.Time // The time at which Go or Call was invoked.
+}
+
+// A Snapshot is a point-in-time view of the tasks being executed by a
+// Context and by any live Contexts derived from it.
+type Snapshot struct {
+	Children []*Snapshot // Ordered by creation time.
+	Started  time.Time   // The time at which the Context was created.
+	Stopping bool        // True if Stop has been called.
+	Tasks    []TaskInfo  // Ordered by start time.
+}
+
+// Snapshot returns a tree that describes the tasks that are currently
+// running within the Context and within any Contexts that were derived
+// from it via [WithContext]. This is intended as a diagnostic tool to
+// determine which tasks are preventing a Context from stopping.
+func (c *Context) Snapshot() *Snapshot {
+	c.mu.RLock()
+	ret := &Snapshot{
+		Started:  c.started,
+		Stopping: c.mu.stopping,
+		Tasks:    make([]TaskInfo, 0, len(c.mu.tasks)),
+	}
+	for t := range c.mu.tasks {
+		ret.Tasks = append(ret.Tasks, t.info())
+	}
+	children := make([]*Context, 0, len(c.mu.children))
+	for child := range c.mu.children {
+		children = append(children, child)
+	}
+	// Release the lock before descending to avoid lock-order problems.
+	c.mu.RUnlock()
+
+	sort.SliceStable(ret.Tasks, func(i, j int) bool {
+		return ret.Tasks[i].Started.Before(ret.Tasks[j].Started)
+	})
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].started.Before(children[j].started)
+	})
+	for _, child := range children {
+		snap := child.Snapshot()
+		// Omit children that are in the process of shutting down, or
+		// that were created internally to run a task and have no
+		// nested tasks of their own.
+		if (child.internal || child.Err() != nil) && snap.Len() == 0 {
+			continue
+		}
+		ret.Children = append(ret.Children, snap)
+	}
+	return ret
+}
+
+// Labels returns the labels of all tasks in the tree. Unlabeled tasks
+// are omitted.
+func (s *Snapshot) Labels() []string {
+	var ret []string
+	for _, t := range s.Tasks {
+		if t.Label != "" {
+			ret = append(ret, t.Label)
+		}
+	}
+	for _, child := range s.Children {
+		ret = append(ret, child.Labels()...)
+	}
+	return ret
+}
+
+// Len returns the total number of tasks in the tree.
+func (s *Snapshot) Len() int {
+	ret := len(s.Tasks)
+	for _, child := range s.Children {
+		ret += child.Len()
+	}
+	return ret
+}
+
+// String returns an indented, human-readable description of the tree.
+func (s *Snapshot) String() string {
+	var sb strings.Builder
+	s.format(&sb, time.Now(), 0)
+	return sb.String()
+}
+
+func (s *Snapshot) format(sb *strings.Builder, now time.Time, depth int) {
+	indent := strings.Repeat("  ", depth)
+	state := "running"
+	if s.Stopping {
+		state = "stopping"
+	}
+	fmt.Fprintf(sb, "%scontext (%s, age %s)\n",
+		indent, state, now.Sub(s.Started).Round(time.Millisecond))
+	for _, t := range s.Tasks {
+		label := t.Label
+		if label == "" {
+			label = "<unlabeled>"
+		}
+		fmt.Fprintf(sb, "%s  task %q (running %s)\n",
+			indent, label, now.Sub(t.Started).Round(time.Millisecond))
+	}
+	for _, child := range s.Children {
+		child.format(sb, now, depth+1)
+	}
+}
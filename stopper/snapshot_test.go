@@ -0,0 +1,70 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	r := require.New(t)
+
+	parent := WithContext(context.Background())
+	child := WithContext(parent)
+
+	waitFor := make(chan struct{})
+	r.True(parent.Go(func(*Context) error { <-waitFor; return nil }, TaskLabel("outer")))
+	r.True(child.Go(func(*Context) error { <-waitFor; return nil }, TaskLabel("inner")))
+	r.True(child.Go(func(*Context) error { <-waitFor; return nil }))
+
+	r.NoError(child.Call(func(*Context) error {
+		snap := parent.Snapshot()
+		r.Equal(4, snap.Len())
+		r.Equal([]string{"outer", "inner", "call"}, snap.Labels())
+		r.Len(snap.Tasks, 1)
+		r.Len(snap.Children, 1)
+		r.Len(snap.Children[0].Tasks, 3)
+		r.False(snap.Stopping)
+
+		str := snap.String()
+		r.Contains(str, `task "outer"`)
+		r.Contains(str, `task "inner"`)
+		r.Contains(str, `task "<unlabeled>"`)
+		return nil
+	}, TaskLabel("call")))
+
+	// Finished tasks are removed from the tree.
+	r.Equal([]string{"outer", "inner"}, parent.Snapshot().Labels())
+
+	parent.Stop(time.Minute)
+	r.True(parent.Snapshot().Stopping)
+	close(waitFor)
+	r.NoError(parent.Wait())
+	<-child.Done()
+
+	// Stopped children are removed from the tree.
+	snap := parent.Snapshot()
+	r.Zero(snap.Len())
+	r.Empty(snap.Children)
+
+	// Background does not track tasks.
+	r.Zero(Background().Snapshot().Len())
+}
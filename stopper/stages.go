@@ -0,0 +1,113 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Stages coordinates an ordered shutdown of a Context. Each stage is a
+// Context derived from the parent, which will be stopped only after
+// the parent has been stopped and all the stages that it depends upon
+// are done. For example:
+//
+//	stages := stopper.NewStages(ctx)
+//	accept, _ := stages.Add("accept", 5*time.Second)
+//	drain, _ := stages.Add("drain", time.Minute, "accept")
+//	flush, _ := stages.Add("flush", 10*time.Second, "drain")
+//	pools, _ := stages.Add("pools", 0, "flush")
+//
+// Tasks should be started in the stage's Context. Each stage's
+// progress can be observed via its [Context.Stopping] and
+// [Context.Done] channels.
+//
+// Since a stage's tasks are tracked by the parent, the parent will not
+// be canceled until all stages are done. If the parent's grace period
+// expires, all stages will be canceled, regardless of their
+// dependencies. Callers will generally want to stop the parent with a
+// grace period of zero.
+type Stages struct {
+	parent *Context
+
+	mu struct {
+		sync.Mutex
+		stages map[string]*Context
+	}
+}
+
+// NewStages constructs a Stages that will coordinate the shutdown of
+// the Context.
+func NewStages(ctx *Context) *Stages {
+	ret := &Stages{parent: ctx}
+	ret.mu.stages = make(map[string]*Context)
+	return ret
+}
+
+// Add creates a new stage. Once the parent Context has been stopped
+// and the named stages that it depends upon are done, the stage will
+// be stopped with the given grace period. Dependencies must already
+// have been added, which prevents cycles from being introduced.
+func (s *Stages) Add(name string, gracePeriod time.Duration, after ...string) (*Context, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.parent.IsStopping() {
+		return nil, ErrStopped
+	}
+	if _, dup := s.mu.stages[name]; dup {
+		return nil, fmt.Errorf("stage %q already exists", name)
+	}
+	deps := make([]*Context, len(after))
+	for i, dep := range after {
+		found, ok := s.mu.stages[dep]
+		if !ok {
+			return nil, fmt.Errorf("stage %q depends on unknown stage %q", name, dep)
+		}
+		deps[i] = found
+	}
+
+	stage := newContext(s.parent, nil)
+	s.mu.stages[name] = stage
+
+	go func() {
+		select {
+		case <-s.parent.Stopping():
+		case <-stage.Done():
+			stage.Stop(0)
+			return
+		}
+		for _, dep := range deps {
+			select {
+			case <-dep.Done():
+			case <-stage.Done():
+				stage.Stop(0)
+				return
+			}
+		}
+		stage.Stop(gracePeriod)
+	}()
+	return stage, nil
+}
+
+// Get returns the named stage, or nil if it has not been added.
+func (s *Stages) Get(name string) *Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mu.stages[name]
+}
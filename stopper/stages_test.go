@@ -0,0 +1,119 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStages(t *testing.T) {
+	r := require.New(t)
+
+	parent := WithContext(context.Background())
+	stages := NewStages(parent)
+
+	accept, err := stages.Add("accept", time.Minute)
+	r.NoError(err)
+	drain, err := stages.Add("drain", time.Minute, "accept")
+	r.NoError(err)
+	flush, err := stages.Add("flush", time.Minute, "accept")
+	r.NoError(err)
+	pools, err := stages.Add("pools", time.Minute, "drain", "flush")
+	r.NoError(err)
+	r.Same(drain, stages.Get("drain"))
+	r.Nil(stages.Get("unknown"))
+
+	_, err = stages.Add("accept", 0)
+	r.ErrorContains(err, "already exists")
+	_, err = stages.Add("other", 0, "unknown")
+	r.ErrorContains(err, "unknown stage")
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) func(ctx *Context) error {
+		return func(ctx *Context) error {
+			<-ctx.Stopping()
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	// Allow the drain stage to be held open.
+	releaseDrain := make(chan struct{})
+	r.True(accept.Go(record("accept")))
+	r.True(drain.Go(func(ctx *Context) error {
+		<-releaseDrain
+		return record("drain")(ctx)
+	}))
+	r.True(flush.Go(record("flush")))
+	r.True(pools.Go(record("pools")))
+
+	parent.Stop(0)
+
+	select {
+	case <-flush.Done():
+	case <-time.After(time.Second):
+		r.Fail("timed out waiting for flush")
+	}
+
+	// The pools stage must wait for drain to finish.
+	select {
+	case <-pools.Stopping():
+		r.Fail("pools stage should not be stopping")
+	case <-time.After(10 * time.Millisecond):
+	}
+	r.NoError(parent.Err())
+	close(releaseDrain)
+
+	r.NoError(parent.Wait())
+	r.Equal("pools", order[len(order)-1])
+	r.Equal("accept", order[0])
+	r.ElementsMatch([]string{"drain", "flush"}, order[1:3])
+
+	// Can't add stages once stopped.
+	_, err = stages.Add("late", 0)
+	r.ErrorIs(err, ErrStopped)
+}
+
+func TestStagesParentCanceled(t *testing.T) {
+	r := require.New(t)
+
+	top, cancel := context.WithCancel(context.Background())
+	parent := WithContext(top)
+	stages := NewStages(parent)
+	first, err := stages.Add("first", time.Minute)
+	r.NoError(err)
+	second, err := stages.Add("second", time.Minute, "first")
+	r.NoError(err)
+	r.True(first.Go(stuckTask))
+	r.True(second.Go(stuckTask))
+
+	cancel()
+	select {
+	case <-second.Stopping():
+	case <-time.After(time.Second):
+		r.Fail("timed out waiting for second stage")
+	}
+	r.NoError(parent.Wait())
+}
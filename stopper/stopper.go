@@ -39,7 +39,9 @@ var background = &Context{
 var ErrStopped = errors.New("stopped")
 
 // ErrGracePeriodExpired will be returned from [context.Cause] when the
-// Context has been stopped, but the goroutines have not exited.
+// Context has been stopped, but the goroutines have not exited. The
+// [DumpStacks] option may be used to determine which goroutines failed
+// to exit.
 var ErrGracePeriodExpired = errors.New("grace period expired")
 
 // A Context is conceptually similar to an [errgroup.Group] in that it
@@ -56,14 +58,23 @@ type Context struct {
 	cancel   func(error) // Invoked via cancelLocked.
 	delegate context.Context
 	stopping chan struct{}
+	internal bool // Created to run a task; see invokeWithTimeout.
+	opts     options
 	parent   *Context
+	started  time.Time
 
 	mu struct {
 		sync.RWMutex
-		count    int
-		deferred []func()
-		err      error
-		stopping bool
+		children    map[*Context]struct{}
+		cleaned     chan struct{} // Non-nil once cleanup has started.
+		cleaning    bool          // True while callbacks are being run.
+		cleanupErrs []error
+		count       int
+		deferred    []func(ctx context.Context) error
+		errs        []TaskError
+		reporting   bool // Defers cancellation while Stop notifies the Observer.
+		stopping    bool
+		tasks       map[*task]struct{}
 	}
 }
 
@@ -95,12 +106,43 @@ func IsStopping(ctx context.Context) bool {
 	return From(ctx).IsStopping()
 }
 
+// An Option configures a Context that is constructed by [WithContext].
+// A Context inherits the options of the Context that it is derived
+// from.
+type Option func(o *options)
+
+// options holds the configuration set by Option values.
+type options struct {
+	cleanupBudget time.Duration           // Set by CleanupBudget.
+	collectErrors bool                    // Set by CollectErrors.
+	dumpStacks    bool                    // Set by DumpStacks.
+	observer      Observer                // Set by Observe.
+	recoverPanics bool                    // Set by RecoverPanics.
+	stackSink     func(*GracePeriodError) // Set by DumpStacks, may be nil.
+}
+
 // WithContext creates a new Context whose work will be immediately
 // canceled when the parent context is canceled. If the provided context
 // is already managed by a Context, a call to the enclosing
 // [Context.Stop] method will also trigger a call to Stop in the
 // newly-constructed Context.
-func WithContext(ctx context.Context) *Context {
+func WithContext(ctx context.Context, opts ...Option) *Context {
+	s := newContext(ctx, opts)
+	go s.stopWithParent()
+	return s
+}
+
+// newContext constructs a Context, but does not arrange for it to be
+// stopped when the parent is stopped.
+func newContext(ctx context.Context, opts []Option) *Context {
+	s := allocContext(ctx, opts)
+	s.parent.addChild(s)
+	return s
+}
+
+// allocContext constructs a Context that has not yet been registered
+// with its parent.
+func allocContext(ctx context.Context, opts []Option) *Context {
 	// Might be background, which never stops.
 	parent := From(ctx)
 
@@ -108,41 +150,52 @@ func WithContext(ctx context.Context) *Context {
 	s := &Context{
 		cancel:   cancel,
 		delegate: ctx,
+		opts:     parent.opts,
 		parent:   parent,
+		started:  time.Now(),
 		stopping: make(chan struct{}),
 	}
-
-	// Propagate a parent stop or context cancellation into a Stop call
-	// to ensure that all notification channels are closed.
-	go func() {
-		select {
-		case <-parent.Stopping():
-		case <-s.Done():
-		}
-		s.Stop(0)
-	}()
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
 	return s
 }
 
+// stopWithParent propagates a parent stop or context cancellation into
+// a Stop call to ensure that all notification channels are closed.
+func (c *Context) stopWithParent() {
+	select {
+	case <-c.parent.Stopping():
+	case <-c.Done():
+	}
+	c.Stop(0)
+}
+
 // Call executes the given function within the current goroutine and
 // monitors its lifecycle. That is, both Call and Wait will block until
-// the function has returned.
+// the function has returned. The options may be used to label the
+// task, which will be reported by [Context.Snapshot], or to set a
+// timeout via [TaskTimeout].
 //
 // Call returns any error from the function with no other side effects.
 // Unlike the Go method, Call does not stop the Context if the function
 // returns an error. If the Context has already been stopped,
-// [ErrStopped] will be returned.
+// [ErrStopped] will be returned. If the Context was constructed with
+// [RecoverPanics], a panic in the function will be returned as a
+// [*PanicError].
 //
 // The function passed to Call should prefer the [Context.Stopping]
 // channel to return instead of depending on [Context.Done]. This allows
 // a soft-stop, rather than waiting for the grace period to expire when
 // [Context.Stop] is called.
-func (c *Context) Call(fn func(ctx *Context) error) error {
-	if !c.apply(1) {
+func (c *Context) Call(fn func(ctx *Context) error, opts ...TaskOption) (err error) {
+	t := newTask(opts)
+	if !c.begin(t) {
 		return ErrStopped
 	}
-	defer c.apply(-1)
-	return fn(c)
+	defer func() { c.end(t, err) }()
+	c.captureID(t)
+	return c.invoke(t, fn)
 }
 
 // Deadline implements [context.Context].
@@ -155,21 +208,16 @@ func (c *Context) Deadline() (deadline time.Time, ok bool) { return c.delegate.D
 // been canceled by the time the callback is run, so its behaviors
 // should be associated with [context.Background] or similar. Callbacks
 // will be executed in a LIFO manner. If the Context has already
-// stopped, the callback will be executed immediately.
+// stopped, the callback will be executed immediately. See also
+// [Context.DeferCleanup].
 //
 // Calling this method on the Background context will panic, since that
 // context can never be cancelled.
 func (c *Context) Defer(fn func()) {
-	if c == background {
-		panic(errors.New("cannot call Context.Defer() on a background context"))
-	}
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.Err() != nil {
+	c.DeferCleanup(func(context.Context) error {
 		fn()
-		return
-	}
-	c.mu.deferred = append(c.mu.deferred, fn)
+		return nil
+	})
 }
 
 // Done implements [context.Context]. The channel that is returned will
@@ -193,11 +241,13 @@ func (c *Context) Len() int {
 }
 
 // Go spawns a new goroutine to execute the given function and monitors
-// its lifecycle.
+// its lifecycle. The options may be used to label the task, which will
+// be reported by [Context.Snapshot], or to set a timeout via
+// [TaskTimeout].
 //
 // If the function returns an error, the Stop method will be called. The
 // returned error will be available from Wait once the remaining
-// goroutines have exited.
+// goroutines have exited. See also [CollectErrors] and [RecoverPanics].
 //
 // This method will not execute the function and return false if Stop
 // has already been called.
@@ -206,20 +256,19 @@ func (c *Context) Len() int {
 // channel to return instead of depending on [Context.Done]. This allows
 // a soft-stop, rather than waiting for the grace period to expire when
 // [Context.Stop] is called.
-func (c *Context) Go(fn func(ctx *Context) error) (accepted bool) {
-	if !c.apply(1) {
+func (c *Context) Go(fn func(ctx *Context) error, opts ...TaskOption) (accepted bool) {
+	t := newTask(opts)
+	if !c.begin(t) {
 		return false
 	}
 
 	go func() {
-		defer c.apply(-1)
-		if err := fn(c); err != nil {
+		var err error
+		defer func() { c.end(t, err) }()
+		c.captureID(t)
+		if err = c.invoke(t, fn); err != nil {
 			c.Stop(0)
-			c.mu.Lock()
-			defer c.mu.Unlock()
-			if c.mu.err == nil {
-				c.mu.err = err
-			}
+			c.recordError(t, err)
 		}
 	}()
 	return true
@@ -244,17 +293,35 @@ func (c *Context) Stop(gracePeriod time.Duration) {
 		return
 	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	if c.mu.stopping {
+		c.mu.Unlock()
 		return
 	}
 	c.mu.stopping = true
 	close(c.stopping)
 
-	// Cancel the context if nothing's currently running.
+	// Report the stop without holding the lock, but before the Context
+	// can be canceled. Contexts used internally to run a task are not
+	// reported.
+	if obs := c.opts.observer; obs != nil && !c.internal {
+		c.mu.reporting = true
+		c.mu.Unlock()
+		obs.StopRequested(c, gracePeriod)
+		c.mu.Lock()
+		c.mu.reporting = false
+	}
+
+	// Cancel the context if nothing's currently running. Any deferred
+	// callbacks are run once the lock has been released.
+	var cleanup func()
+	defer func() {
+		if cleanup != nil {
+			cleanup()
+		}
+	}()
+	defer c.mu.Unlock()
 	if c.mu.count == 0 {
-		c.cancelLocked(ErrStopped)
+		cleanup = c.cancelLocked(ErrStopped)
 	} else if gracePeriod > 0 {
 		go func() {
 			select {
@@ -262,9 +329,7 @@ func (c *Context) Stop(gracePeriod time.Duration) {
 				// Cancel after the grace period has expired. This
 				// should immediately terminate any well-behaved
 				// goroutines driven by Go().
-				c.mu.Lock()
-				defer c.mu.Unlock()
-				c.cancelLocked(ErrGracePeriodExpired)
+				c.expireGracePeriod()
 			case <-c.Done():
 				// We'll hit this path in a clean-exit, where apply()
 				// cancels the context after the last goroutine has
@@ -291,22 +356,73 @@ func (c *Context) Value(key any) any {
 // Wait will block until Stop has been called and all associated
 // goroutines have exited or the parent context has been cancelled. This
 // method will return the first, non-nil error from any of the callbacks
-// passed to Go. If Wait is called on the [Background] instance, it will
-// immediately return nil.
+// passed to Go. If the Context was constructed with the [CollectErrors]
+// option, all errors will be returned, as though by [errors.Join].
+// Wait will also block until any callbacks registered via
+// [Context.Defer] have been executed and will include errors returned
+// from [Context.DeferCleanup] callbacks. If Wait is called on the
+// [Background] instance, it will immediately return nil.
 func (c *Context) Wait() error {
 	if c == background {
 		return nil
 	}
 	<-c.Done()
 
+	c.mu.RLock()
+	cleaned := c.mu.cleaned
+	c.mu.RUnlock()
+	if cleaned != nil {
+		<-cleaned
+	}
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.mu.err
+	var err error
+	switch len(c.mu.errs) {
+	case 0:
+	case 1:
+		err = c.mu.errs[0].Err
+	default:
+		errs := make([]error, len(c.mu.errs))
+		for i, err := range c.mu.errs {
+			errs[i] = err.Err
+		}
+		err = errors.Join(errs...)
+	}
+	if len(c.mu.cleanupErrs) > 0 {
+		err = errors.Join(append([]error{err}, c.mu.cleanupErrs...)...)
+	}
+	return err
 }
 
 // apply is used to maintain the count of started goroutines. It returns
 // true if the delta was applied.
 func (c *Context) apply(delta int) bool {
+	return c.adjust(delta, true)
+}
+
+// hold is like apply, but the delta is not propagated to the parent.
+// This allows a Context to be kept alive without the parent counting
+// an additional task.
+func (c *Context) hold(delta int) bool {
+	return c.adjust(delta, false)
+}
+
+// adjust implements apply and hold.
+func (c *Context) adjust(delta int, propagate bool) bool {
+	var cleanups []func()
+	ok := c.applyLocked(delta, propagate, &cleanups)
+	// Run the callbacks of the innermost Context first, now that no
+	// locks are held.
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+	return ok
+}
+
+// applyLocked implements adjust. Any deferred callbacks that must be
+// run as a result of cancellation are appended to cleanups.
+func (c *Context) applyLocked(delta int, propagate bool, cleanups *[]func()) bool {
 	if c == background {
 		return true
 	}
@@ -323,7 +439,7 @@ func (c *Context) apply(delta int) bool {
 	// context to prevent premature cancellation. Verify that the parent
 	// accepted the delta in case it was just stopped, but our helper
 	// goroutine hasn't yet called Stop on this instance.
-	if !c.parent.apply(delta) {
+	if propagate && !c.parent.applyLocked(delta, true, cleanups) {
 		return false
 	}
 
@@ -332,18 +448,81 @@ func (c *Context) apply(delta int) bool {
 		// Implementation error, not user problem.
 		panic("over-released")
 	}
-	if c.mu.count == 0 && c.mu.stopping {
-		c.cancelLocked(ErrStopped)
+	if c.mu.count == 0 && c.mu.stopping && !c.mu.reporting {
+		if cleanup := c.cancelLocked(ErrStopped); cleanup != nil {
+			*cleanups = append(*cleanups, cleanup)
+		}
 	}
 	return true
 }
 
-// cancelLocked invokes the context-cancellation function and then
-// executes any deferred callbacks.
-func (c *Context) cancelLocked(err error) {
+// addChild records a Context derived from the receiver so that it may
+// be reported by Snapshot.
+func (c *Context) addChild(child *Context) {
+	if c == background {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mu.children == nil {
+		c.mu.children = make(map[*Context]struct{})
+	}
+	c.mu.children[child] = struct{}{}
+}
+
+// begin is called when a task is started. It returns false if the
+// task should not be executed.
+func (c *Context) begin(t *task) bool {
+	if !c.apply(1) {
+		return false
+	}
+	if c == background {
+		return true
+	}
+	c.mu.Lock()
+	if c.mu.tasks == nil {
+		c.mu.tasks = make(map[*task]struct{})
+	}
+	c.mu.tasks[t] = struct{}{}
+	c.mu.Unlock()
+
+	if obs := c.opts.observer; obs != nil {
+		obs.TaskStarted(c, t.info())
+	}
+	return true
+}
+
+// end is called when a task started by begin has finished.
+func (c *Context) end(t *task, err error) {
+	if c != background {
+		c.mu.Lock()
+		delete(c.mu.tasks, t)
+		c.mu.Unlock()
+
+		if obs := c.opts.observer; obs != nil {
+			obs.TaskFinished(c, t.info(), time.Since(t.started), err)
+		}
+	}
+	c.apply(-1)
+}
+
+// cancelLocked invokes the context-cancellation function. It returns a
+// function that executes any deferred callbacks, which the caller must
+// invoke once the lock has been released. The return value will be
+// nil if cancellation had already occurred.
+func (c *Context) cancelLocked(err error) (cleanup func()) {
+	if c.parent != background {
+		// Lock order is always child, then parent.
+		c.parent.mu.Lock()
+		delete(c.parent.mu.children, c)
+		c.parent.mu.Unlock()
+	}
 	c.cancel(err)
-	for i := len(c.mu.deferred) - 1; i >= 0; i-- {
-		c.mu.deferred[i]()
+	if c.mu.cleaned != nil {
+		// Cleanup has already started.
+		return nil
 	}
-	c.mu.deferred = nil
+	c.mu.cleaned = make(chan struct{})
+	c.mu.cleaning = true
+	return c.cleanup
 }
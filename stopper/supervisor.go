@@ -0,0 +1,268 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRestartIntensity is returned from [Context.Wait] when a
+// [Supervisor] has restarted its tasks too frequently.
+var ErrRestartIntensity = errors.New("restart intensity exceeded")
+
+// A Strategy determines which tasks a [Supervisor] will restart when a
+// task fails.
+type Strategy int
+
+// Supported strategies.
+const (
+	// OneForOne restarts only the task that failed.
+	OneForOne Strategy = iota
+	// OneForAll stops all tasks when any task fails and then restarts
+	// all of them.
+	OneForAll
+)
+
+// SupervisorConfig controls the behavior of a [Supervisor].
+type SupervisorConfig struct {
+	// The initial delay before restarting a failed task. The delay will
+	// double with each consecutive failure. Defaults to 100ms.
+	MinBackoff time.Duration
+	// The maximum delay before restarting a failed task. Defaults to
+	// 30s.
+	MaxBackoff time.Duration
+	// The maximum number of restarts that may occur within Period
+	// before the Supervisor gives up. Defaults to 5.
+	MaxRestarts int
+	// The window of time used to measure restart intensity. A task
+	// that runs for at least this long will also have its backoff
+	// reset. Defaults to one minute.
+	Period time.Duration
+	// Determines which tasks are restarted.
+	Strategy Strategy
+}
+
+// A Supervisor executes long-running tasks and restarts them with an
+// exponential backoff if they return an error. This is in contrast to
+// [Context.Go], which stops the Context when a task returns an error.
+// If the tasks are restarted more than MaxRestarts times within the
+// configured Period, the Supervisor will stop the enclosing Context
+// and an error wrapping [ErrRestartIntensity] will be returned from
+// [Context.Wait].
+//
+// Supervised tasks are executed within Contexts derived from the one
+// passed to [NewSupervisor]. A task which returns nil will not be
+// restarted, unless it was interrupted by the [OneForAll] strategy.
+type Supervisor struct {
+	cfg    SupervisorConfig
+	ctx    *Context
+	failed chan *supervised
+
+	mu struct {
+		sync.Mutex
+		gen      *Context // The Context used to run tasks.
+		restarts []time.Time
+		tasks    []*supervised
+	}
+}
+
+// supervised holds the state for a task executed by a Supervisor.
+type supervised struct {
+	fn    func(ctx *Context) error
+	label string
+
+	// Accessed only by the goroutine executing the task or by
+	// Supervisor.run.
+	err      error
+	failures int
+	gen      *Context
+}
+
+// NewSupervisor constructs a Supervisor which executes tasks within the
+// Context. The Supervisor itself is executed as a task within the
+// Context.
+func NewSupervisor(ctx *Context, cfg SupervisorConfig) *Supervisor {
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	if cfg.MaxRestarts <= 0 {
+		cfg.MaxRestarts = 5
+	}
+	if cfg.Period <= 0 {
+		cfg.Period = time.Minute
+	}
+	s := &Supervisor{
+		cfg:    cfg,
+		ctx:    ctx,
+		failed: make(chan *supervised),
+	}
+	s.mu.gen = WithContext(ctx)
+	ctx.Go(s.run, TaskLabel("supervisor"))
+	return s
+}
+
+// Go starts a supervised task. The label will be applied to each
+// execution of the task. This method will return false if the
+// enclosing Context has been stopped.
+func (s *Supervisor) Go(label string, fn func(ctx *Context) error) (accepted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.IsStopping() {
+		return false
+	}
+	sv := &supervised{fn: fn, label: label}
+	s.mu.tasks = append(s.mu.tasks, sv)
+	s.start(s.mu.gen, sv, 0)
+	return true
+}
+
+// start executes the task in the given Context after a delay.
+func (s *Supervisor) start(gen *Context, sv *supervised, delay time.Duration) {
+	gen.Go(func(ctx *Context) error {
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Stopping():
+				return nil
+			}
+		}
+		began := time.Now()
+		err := ctx.invoke(&task{label: sv.label}, sv.fn)
+		if ctx.IsStopping() {
+			// The task was interrupted, either because the Supervisor
+			// is stopping or to be restarted by OneForAll.
+			return nil
+		}
+		if err == nil {
+			s.remove(sv)
+			return nil
+		}
+		if time.Since(began) >= s.cfg.Period {
+			sv.failures = 0
+		}
+		sv.err = err
+		sv.gen = gen
+		select {
+		case s.failed <- sv:
+		case <-ctx.Stopping():
+		}
+		return nil
+	}, TaskLabel(sv.label))
+}
+
+// run is the main loop of the Supervisor.
+func (s *Supervisor) run(ctx *Context) error {
+	for {
+		var sv *supervised
+		select {
+		case sv = <-s.failed:
+		case <-ctx.Stopping():
+			return nil
+		}
+
+		s.mu.Lock()
+		if sv.gen != s.mu.gen {
+			// A straggler from a generation that was already restarted.
+			s.mu.Unlock()
+			continue
+		}
+		if err := s.recordRestartLocked(sv); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		delay := s.backoff(sv)
+
+		switch s.cfg.Strategy {
+		case OneForOne:
+			s.start(s.mu.gen, sv, delay)
+			s.mu.Unlock()
+
+		case OneForAll:
+			old := s.mu.gen
+			s.mu.Unlock()
+
+			// Wait for all other tasks to exit.
+			old.Stop(0)
+			select {
+			case <-old.Done():
+			case <-ctx.Stopping():
+				return nil
+			}
+
+			s.mu.Lock()
+			if ctx.IsStopping() {
+				s.mu.Unlock()
+				return nil
+			}
+			s.mu.gen = WithContext(ctx)
+			for _, restart := range s.mu.tasks {
+				s.start(s.mu.gen, restart, delay)
+			}
+			s.mu.Unlock()
+
+		default:
+			s.mu.Unlock()
+			return fmt.Errorf("unknown strategy %d", s.cfg.Strategy)
+		}
+	}
+}
+
+// backoff computes the delay before restarting the task.
+func (s *Supervisor) backoff(sv *supervised) time.Duration {
+	delay := s.cfg.MinBackoff
+	for i := 0; i < sv.failures && delay < s.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	sv.failures++
+	return min(delay, s.cfg.MaxBackoff)
+}
+
+// remove forgets a task that has completed normally.
+func (s *Supervisor) remove(sv *supervised) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, candidate := range s.mu.tasks {
+		if candidate == sv {
+			s.mu.tasks = append(s.mu.tasks[:i], s.mu.tasks[i+1:]...)
+			return
+		}
+	}
+}
+
+// recordRestartLocked returns an error if restarting the task would
+// exceed the configured restart intensity.
+func (s *Supervisor) recordRestartLocked(sv *supervised) error {
+	now := time.Now()
+	cutoff := now.Add(-s.cfg.Period)
+	idx := 0
+	for idx < len(s.mu.restarts) && s.mu.restarts[idx].Before(cutoff) {
+		idx++
+	}
+	s.mu.restarts = append(s.mu.restarts[idx:], now)
+	if len(s.mu.restarts) > s.cfg.MaxRestarts {
+		return fmt.Errorf("%w: %s: %w", ErrRestartIntensity, sv.label, sv.err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisorOneForOne(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	sup := NewSupervisor(s, SupervisorConfig{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 100,
+	})
+
+	var flakyCalls, stableCalls atomic.Int32
+	done := make(chan struct{})
+	r.True(sup.Go("flaky", func(*Context) error {
+		if flakyCalls.Add(1) < 3 {
+			return errors.New("flaky")
+		}
+		close(done)
+		return nil
+	}))
+	r.True(sup.Go("stable", func(ctx *Context) error {
+		stableCalls.Add(1)
+		<-ctx.Stopping()
+		return nil
+	}))
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		r.Fail("timed out waiting for restarts")
+	}
+	r.Equal(int32(3), flakyCalls.Load())
+
+	s.Stop(time.Second)
+	r.NoError(s.Wait())
+	r.Equal(int32(1), stableCalls.Load())
+	r.False(sup.Go("late", func(*Context) error { return nil }))
+}
+
+func TestSupervisorOneForAll(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	sup := NewSupervisor(s, SupervisorConfig{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 100,
+		Strategy:    OneForAll,
+	})
+
+	var flakyCalls, stableCalls atomic.Int32
+	r.True(sup.Go("stable", func(ctx *Context) error {
+		stableCalls.Add(1)
+		<-ctx.Stopping()
+		return nil
+	}))
+	r.True(sup.Go("flaky", func(ctx *Context) error {
+		if flakyCalls.Add(1) < 3 {
+			return errors.New("flaky")
+		}
+		<-ctx.Stopping()
+		return nil
+	}))
+
+	r.Eventually(func() bool {
+		return flakyCalls.Load() == 3 && stableCalls.Load() == 3
+	}, 10*time.Second, time.Millisecond)
+
+	s.Stop(time.Second)
+	r.NoError(s.Wait())
+}
+
+// Verify that tasks which have completed are neither restarted nor
+// retained.
+func TestSupervisorOneForAllCompleted(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	sup := NewSupervisor(s, SupervisorConfig{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 100,
+		Strategy:    OneForAll,
+	})
+	taskCount := func() int {
+		sup.mu.Lock()
+		defer sup.mu.Unlock()
+		return len(sup.mu.tasks)
+	}
+
+	var doneCalls, flakyCalls atomic.Int32
+	r.True(sup.Go("done", func(*Context) error {
+		doneCalls.Add(1)
+		return nil
+	}))
+	r.Eventually(func() bool { return taskCount() == 0 }, 10*time.Second, time.Millisecond)
+
+	r.True(sup.Go("flaky", func(ctx *Context) error {
+		if flakyCalls.Add(1) < 3 {
+			return errors.New("flaky")
+		}
+		<-ctx.Stopping()
+		return nil
+	}))
+	r.Eventually(func() bool { return flakyCalls.Load() == 3 }, 10*time.Second, time.Millisecond)
+	r.Equal(int32(1), doneCalls.Load())
+	r.Equal(1, taskCount())
+
+	s.Stop(time.Second)
+	r.NoError(s.Wait())
+}
+
+func TestSupervisorIntensity(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	sup := NewSupervisor(s, SupervisorConfig{
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  2 * time.Millisecond,
+		MaxRestarts: 3,
+		Period:      time.Hour,
+	})
+
+	boom := errors.New("BOOM")
+	var calls atomic.Int32
+	r.True(sup.Go("broken", func(*Context) error {
+		calls.Add(1)
+		return boom
+	}))
+
+	err := s.Wait()
+	r.ErrorIs(err, ErrRestartIntensity)
+	r.ErrorIs(err, boom)
+	r.ErrorContains(err, "broken")
+	r.Equal(int32(4), calls.Load())
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	r := require.New(t)
+
+	sup := &Supervisor{cfg: SupervisorConfig{
+		MinBackoff: time.Second,
+		MaxBackoff: 5 * time.Second,
+	}}
+	sv := &supervised{}
+	r.Equal(time.Second, sup.backoff(sv))
+	r.Equal(2*time.Second, sup.backoff(sv))
+	r.Equal(4*time.Second, sup.backoff(sv))
+	r.Equal(5*time.Second, sup.backoff(sv))
+	r.Equal(5*time.Second, sup.backoff(sv))
+}
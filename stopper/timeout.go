@@ -0,0 +1,94 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTaskTimeout is returned by a task that was started with the
+// [TaskTimeout] option and which did not complete in time. It will
+// also be returned from [context.Cause] if the task's Context is
+// canceled because the grace period has expired.
+var ErrTaskTimeout = errors.New("task timed out")
+
+// TaskTimeout executes the task's function with a Context derived from
+// the one passed to [Context.Go] or [Context.Call]. When the timeout
+// elapses, the derived Context's [Context.Stopping] channel will be
+// closed. If the function has not returned within the additional grace
+// period, the derived Context will be canceled. The derived Context's
+// [Context.Deadline] method will report the time at which it will be
+// canceled.
+//
+// If the timeout elapses, the task's error will wrap
+// [ErrTaskTimeout]. As with any other error, this will stop the
+// enclosing Context if the task was started by [Context.Go].
+func TaskTimeout(timeout, gracePeriod time.Duration) TaskOption {
+	return func(t *task) {
+		t.timeout = timeout
+		t.timeoutGrace = gracePeriod
+	}
+}
+
+// invokeWithTimeout executes the function using a derived Context.
+func (c *Context) invokeWithTimeout(t *task, fn func(ctx *Context) error) error {
+	deadline := time.Now().Add(t.timeout)
+	withDeadline, cancel := context.WithDeadlineCause(
+		c, deadline.Add(t.timeoutGrace), ErrTaskTimeout)
+	defer cancel()
+
+	// The task is already registered with the receiver, so the child
+	// holds only a count to keep it alive until the function returns.
+	// The count is not propagated, which ensures that the function
+	// will execute, even if the receiver is stopped between the time
+	// that the task was accepted and now. Tasks started within the
+	// child are counted by the receiver, as with any derived Context.
+	child := allocContext(withDeadline, nil)
+	child.internal = true
+	child.parent.addChild(child)
+	child.hold(1)
+	go child.stopWithParent()
+	defer child.Stop(0)
+
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(t.timeout, func() {
+		timedOut.Store(true)
+		child.Stop(0)
+	})
+	defer timer.Stop()
+
+	// Invoke the function without the timeout, to avoid recursion.
+	inner := &task{label: t.label, started: t.started}
+	err := func() error {
+		defer child.hold(-1)
+		return child.invoke(inner, fn)
+	}()
+	switch {
+	case !timedOut.Load():
+		return err
+	case err == nil:
+		return ErrTaskTimeout
+	case errors.Is(err, ErrTaskTimeout):
+		return err
+	default:
+		return fmt.Errorf("%w: %w", ErrTaskTimeout, err)
+	}
+}
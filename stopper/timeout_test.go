@@ -0,0 +1,169 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskTimeoutSoft(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	err := s.Call(func(ctx *Context) error {
+		r.NotSame(s, ctx)
+		deadline, ok := ctx.Deadline()
+		r.True(ok)
+		r.True(deadline.After(time.Now().Add(30 * time.Minute)))
+
+		// Well-behaved tasks observe the Stopping channel.
+		<-ctx.Stopping()
+		r.NoError(ctx.Err())
+		return nil
+	}, TaskTimeout(time.Millisecond, time.Hour))
+	r.ErrorIs(err, ErrTaskTimeout)
+
+	// Consistent with Call, the enclosing Context is not stopped.
+	r.False(s.IsStopping())
+	r.Zero(s.Len())
+}
+
+func TestTaskTimeoutHard(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	r.True(s.Go(func(ctx *Context) error {
+		<-ctx.Done()
+		return context.Cause(ctx)
+	}, TaskTimeout(time.Millisecond, time.Millisecond)))
+
+	err := s.Wait()
+	r.ErrorIs(err, ErrTaskTimeout)
+	r.NotErrorIs(s.Err(), context.DeadlineExceeded)
+	r.ErrorIs(context.Cause(s), ErrStopped)
+}
+
+func TestTaskTimeoutNotExceeded(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	boom := errors.New("BOOM")
+	r.ErrorIs(s.Call(func(*Context) error { return boom }, TaskTimeout(time.Hour, 0)), boom)
+	r.NoError(s.Call(func(*Context) error { return nil }, TaskTimeout(time.Hour, 0)))
+
+	// Wrap errors returned after the timeout.
+	err := s.Call(func(ctx *Context) error {
+		<-ctx.Stopping()
+		return boom
+	}, TaskTimeout(time.Millisecond, time.Hour))
+	r.ErrorIs(err, boom)
+	r.ErrorIs(err, ErrTaskTimeout)
+}
+
+func TestTaskTimeoutParentStop(t *testing.T) {
+	r := require.New(t)
+
+	s := WithContext(context.Background())
+	r.True(s.Go(func(ctx *Context) error {
+		<-ctx.Stopping()
+		return nil
+	}, TaskTimeout(time.Hour, time.Hour)))
+
+	// Stopping the parent propagates to the task.
+	s.Stop(0)
+	r.NoError(s.Wait())
+}
+
+func TestTaskTimeoutTrackedOnce(t *testing.T) {
+	r := require.New(t)
+
+	m := &Metrics{}
+	reported := make(chan *GracePeriodError, 1)
+	s := WithContext(context.Background(), Observe(m), DumpStacks(func(err *GracePeriodError) {
+		reported <- err
+	}))
+
+	running := make(chan struct{})
+	r.True(s.Go(func(ctx *Context) error {
+		close(running)
+		return stuckTask(ctx)
+	}, TaskLabel("slow"), TaskTimeout(time.Hour, time.Hour)))
+	<-running
+
+	snap := s.Snapshot()
+	r.Equal(1, snap.Len())
+	r.Equal([]string{"slow"}, snap.Labels())
+	r.Empty(snap.Children)
+	r.Equal(1, s.Len())
+	r.Equal("1", m.Started.Get("slow").String())
+	r.Equal("1", m.Running.Get("slow").String())
+
+	s.Stop(10 * time.Millisecond)
+	r.NoError(s.Wait())
+
+	var report *GracePeriodError
+	select {
+	case report = <-reported:
+	case <-time.After(time.Second):
+		r.Fail("timed out waiting for report")
+	}
+	r.Len(report.Tasks, 1)
+	r.Equal("slow", report.Tasks[0].Label)
+	r.Contains(report.Error(), "1 task(s) still running")
+}
+
+func TestTaskTimeoutNested(t *testing.T) {
+	r := require.New(t)
+
+	m := &Metrics{}
+	s := WithContext(context.Background(), Observe(m))
+	release := make(chan struct{})
+	nested := make(chan struct{})
+	r.NoError(s.Call(func(ctx *Context) error {
+		r.True(ctx.Go(func(*Context) error {
+			close(nested)
+			<-release
+			return nil
+		}, TaskLabel("nested")))
+		return nil
+	}, TaskLabel("outer"), TaskTimeout(time.Hour, time.Hour)))
+	<-nested
+
+	// The nested task is tracked by the parent and its observer.
+	r.Equal(1, s.Len())
+	r.Equal([]string{"nested"}, s.Snapshot().Labels())
+	r.Equal("1", m.Running.Get("nested").String())
+
+	// The parent waits for the nested task.
+	s.Stop(time.Hour)
+	waited := make(chan error, 1)
+	go func() { waited <- s.Wait() }()
+	select {
+	case <-waited:
+		r.Fail("Wait returned while a nested task was running")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	r.NoError(<-waited)
+	r.Equal("0", m.Running.Get("nested").String())
+	r.Equal(int64(1), m.Stops.Value())
+}
@@ -0,0 +1,235 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopvar
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/field-eng-powertools/notify"
+	"github.com/cockroachdb/field-eng-powertools/stopper"
+)
+
+// Evaluation determines when the value of a [Derived] is computed.
+type Evaluation int
+
+// Supported evaluation strategies.
+const (
+	// Eager recomputes the value in a background goroutine as soon as
+	// any input has changed.
+	Eager Evaluation = iota
+	// Lazy defers computing the value until [Derived.Get] is called.
+	// Listeners will be notified when any input has changed, even if
+	// the computed value turns out to be unchanged.
+	Lazy
+)
+
+// A Derived is a read-only variable whose value is computed from one
+// or more [notify.Source] inputs. It presents the same notification
+// contract as [notify.Var.Get]. A goroutine in the [stopper.Context]
+// used to construct the Derived watches the inputs for changes. Once
+// the context begins to stop, the Derived will retain its last value.
+type Derived[T any] struct {
+	// Returns the next value, or false if the value should not be
+	// updated.
+	compute func() (T, bool)
+	// Returns the notification channels for all inputs.
+	inputs func() []<-chan struct{}
+	lazy   bool
+	settle settleFunc // May be nil.
+	signal notify.Var[struct{}]
+
+	mu struct {
+		sync.Mutex
+		data  T
+		dirty bool
+	}
+}
+
+var _ notify.Source[any] = (*Derived[any])(nil)
+
+// A settleFunc is called after an input has changed to delay the
+// refresh of a Derived. It returns the most recent notification
+// channels of the inputs, or false if the context is stopping.
+type settleFunc func(
+	ctx *stopper.Context, inputs func() []<-chan struct{}, chs []<-chan struct{},
+) ([]<-chan struct{}, bool)
+
+// Combine2 returns a variable which combines the values of two inputs.
+func Combine2[A, B, T any](
+	ctx *stopper.Context,
+	a notify.Source[A],
+	b notify.Source[B],
+	mode Evaluation,
+	fn func(a A, b B) T,
+) *Derived[T] {
+	return newDerived(ctx, mode, nil, func() (T, bool) {
+		aValue, _ := a.Get()
+		bValue, _ := b.Get()
+		return fn(aValue, bValue), true
+	}, changed(a), changed(b))
+}
+
+// Combine3 returns a variable which combines the values of three
+// inputs.
+func Combine3[A, B, C, T any](
+	ctx *stopper.Context,
+	a notify.Source[A],
+	b notify.Source[B],
+	c notify.Source[C],
+	mode Evaluation,
+	fn func(a A, b B, c C) T,
+) *Derived[T] {
+	return newDerived(ctx, mode, nil, func() (T, bool) {
+		aValue, _ := a.Get()
+		bValue, _ := b.Get()
+		cValue, _ := c.Get()
+		return fn(aValue, bValue, cValue), true
+	}, changed(a), changed(b), changed(c))
+}
+
+// Filter returns a variable which tracks the values of the source that
+// satisfy the predicate. If the initial value of the source does not
+// satisfy the predicate, the variable will hold the zero value for T.
+func Filter[T any](
+	ctx *stopper.Context, source notify.Source[T], mode Evaluation, pred func(value T) bool,
+) *Derived[T] {
+	return newDerived(ctx, mode, nil, func() (T, bool) {
+		value, _ := source.Get()
+		return value, pred(value)
+	}, changed(source))
+}
+
+// Map returns a variable whose value is a transformation of the value
+// of the source.
+func Map[S, T any](
+	ctx *stopper.Context, source notify.Source[S], mode Evaluation, fn func(value S) T,
+) *Derived[T] {
+	return newDerived(ctx, mode, nil, func() (T, bool) {
+		value, _ := source.Get()
+		return fn(value), true
+	}, changed(source))
+}
+
+// Get returns the current value and a channel that will be closed when
+// the value may have changed.
+func (d *Derived[T]) Get() (T, <-chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.mu.dirty {
+		d.mu.dirty = false
+		if next, ok := d.compute(); ok {
+			d.mu.data = next
+		}
+	}
+	_, ch := d.signal.Get()
+	return d.mu.data, ch
+}
+
+// refresh is called when an input has changed.
+func (d *Derived[T]) refresh() {
+	if d.lazy {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.mu.dirty = true
+		d.signal.Notify()
+		return
+	}
+
+	next, ok := d.compute()
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mu.data = next
+	d.signal.Notify()
+}
+
+// watch is executed in a goroutine to monitor the inputs.
+func (d *Derived[T]) watch(ctx *stopper.Context, chs []<-chan struct{}) error {
+	for {
+		if _, ok := waitAny(ctx, nil, chs); !ok {
+			return nil
+		}
+		// Collect the new channels before computing the value, so
+		// that we won't miss any updates.
+		chs = d.inputs()
+		if d.settle != nil {
+			var ok bool
+			if chs, ok = d.settle(ctx, d.inputs, chs); !ok {
+				return nil
+			}
+		}
+		d.refresh()
+	}
+}
+
+// newDerived constructs a Derived and starts the goroutine that
+// monitors its inputs.
+func newDerived[T any](
+	ctx *stopper.Context,
+	mode Evaluation,
+	settle settleFunc,
+	compute func() (T, bool),
+	inputs ...func() <-chan struct{},
+) *Derived[T] {
+	d := &Derived[T]{
+		compute: compute,
+		inputs: func() []<-chan struct{} {
+			ret := make([]<-chan struct{}, len(inputs))
+			for i, input := range inputs {
+				ret[i] = input()
+			}
+			return ret
+		},
+		lazy:   mode == Lazy,
+		settle: settle,
+	}
+
+	chs := d.inputs()
+	if next, ok := d.compute(); ok {
+		d.mu.data = next
+	}
+	ctx.Go(func(ctx *stopper.Context) error { return d.watch(ctx, chs) })
+	return d
+}
+
+// changed returns a function that returns the source's current
+// notification channel.
+func changed[T any](source notify.Source[T]) func() <-chan struct{} {
+	return func() <-chan struct{} {
+		_, ch := source.Get()
+		return ch
+	}
+}
+
+// waitAny blocks until any of the channels are closed or the timer, if
+// non-nil, has fired. It returns false if the context is stopping.
+func waitAny(
+	ctx *stopper.Context, timer <-chan time.Time, chs []<-chan struct{},
+) (timedOut, ok bool) {
+	cases := make([]reflect.SelectCase, len(chs)+2)
+	cases[0] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Stopping())}
+	cases[1] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer)}
+	for i, ch := range chs {
+		cases[i+2] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}
+	}
+	chosen, _, _ := reflect.Select(cases)
+	return chosen == 1, chosen != 0
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopvar
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/field-eng-powertools/notify"
+	"github.com/cockroachdb/field-eng-powertools/stopper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapEager(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	stop := stopper.WithContext(ctx)
+
+	v := notify.VarOf(1)
+	var calls atomic.Int32
+	mapped := Map(stop, v, Eager, func(value int) string {
+		calls.Add(1)
+		return strconv.Itoa(value)
+	})
+	found, _ := mapped.Get()
+	r.Equal("1", found)
+
+	v.Set(2)
+	r.NoError(WaitForValue(stop, "2", mapped))
+
+	// Derived values can be chained.
+	doubled := Map(stop, mapped, Eager, func(value string) string { return value + value })
+	r.NoError(WaitForValue(stop, "22", doubled))
+	v.Set(3)
+	r.NoError(WaitForValue(stop, "33", doubled))
+
+	stop.Stop(time.Second)
+	r.NoError(stop.Wait())
+
+	// The last value is retained.
+	found, _ = doubled.Get()
+	r.Equal("33", found)
+	r.Equal(int32(3), calls.Load())
+}
+
+func TestMapLazy(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	stop := stopper.WithContext(ctx)
+
+	v := notify.VarOf(1)
+	var calls atomic.Int32
+	mapped := Map(stop, v, Lazy, func(value int) int {
+		calls.Add(1)
+		return value * 10
+	})
+	found, changed := mapped.Get()
+	r.Equal(10, found)
+	r.Equal(int32(1), calls.Load())
+
+	// Many updates, but no computation until Get is called.
+	for i := 2; i <= 10; i++ {
+		v.Set(i)
+	}
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		r.Fail("timed out waiting for notification")
+	}
+	r.Eventually(func() bool {
+		found, _ := mapped.Get()
+		return found == 100
+	}, time.Second, time.Millisecond)
+	r.Less(calls.Load(), int32(10))
+
+	stop.Stop(time.Second)
+	r.NoError(stop.Wait())
+}
+
+func TestFilter(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	stop := stopper.WithContext(ctx)
+
+	v := notify.VarOf(1)
+	even := Filter(stop, v, Eager, func(value int) bool { return value%2 == 0 })
+	found, _ := even.Get()
+	r.Zero(found)
+
+	v.Set(2)
+	r.NoError(WaitForValue(stop, 2, even))
+
+	_, changed := even.Get()
+	v.Set(3)
+	v.Set(4)
+	<-changed
+	r.NoError(WaitForValue(stop, 4, even))
+
+	stop.Stop(time.Second)
+	r.NoError(stop.Wait())
+}
+
+func TestCombine(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	stop := stopper.WithContext(ctx)
+
+	name := notify.VarOf("a")
+	count := notify.VarOf(1)
+	enabled := notify.VarOf(false)
+
+	two := Combine2(stop, name, count, Eager, func(name string, count int) string {
+		return fmt.Sprintf("%s=%d", name, count)
+	})
+	three := Combine3(stop, name, count, enabled, Lazy,
+		func(name string, count int, enabled bool) string {
+			return fmt.Sprintf("%s=%d,%t", name, count, enabled)
+		})
+	r.NoError(WaitForValue(stop, "a=1", two))
+	r.NoError(WaitForValue(stop, "a=1,false", three))
+
+	name.Set("b")
+	r.NoError(WaitForValue(stop, "b=1", two))
+	count.Set(2)
+	r.NoError(WaitForValue(stop, "b=2", two))
+	enabled.Set(true)
+	r.NoError(WaitForValue(stop, "b=2,true", three))
+
+	stop.Stop(time.Second)
+	r.NoError(stop.Wait())
+}
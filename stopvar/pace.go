@@ -0,0 +1,88 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopvar
+
+import (
+	"time"
+
+	"github.com/cockroachdb/field-eng-powertools/notify"
+	"github.com/cockroachdb/field-eng-powertools/stopper"
+)
+
+// Debounce returns a variable which is updated with the value of the
+// source only once the source has stopped changing for the quiet
+// period. This is useful for coalescing a burst of updates into a
+// single notification.
+func Debounce[T any](
+	ctx *stopper.Context, source notify.Source[T], quiet time.Duration,
+) *Derived[T] {
+	return newDerived(ctx, Eager,
+		func(
+			ctx *stopper.Context, inputs func() []<-chan struct{}, chs []<-chan struct{},
+		) ([]<-chan struct{}, bool) {
+			for {
+				timer := time.NewTimer(quiet)
+				timedOut, ok := waitAny(ctx, timer.C, chs)
+				timer.Stop()
+				if !ok {
+					return nil, false
+				}
+				if timedOut {
+					return chs, true
+				}
+				// The source changed again, so restart the quiet period.
+				chs = inputs()
+			}
+		},
+		func() (T, bool) {
+			value, _ := source.Get()
+			return value, true
+		},
+		changed(source))
+}
+
+// Throttle returns a variable which is updated with the value of the
+// source at most once per interval. Updates made to the source while
+// the variable is waiting for the interval to elapse are coalesced, so
+// that the variable will always receive the latest value.
+func Throttle[T any](
+	ctx *stopper.Context, source notify.Source[T], interval time.Duration,
+) *Derived[T] {
+	var last time.Time
+	return newDerived(ctx, Eager,
+		func(
+			ctx *stopper.Context, inputs func() []<-chan struct{}, chs []<-chan struct{},
+		) ([]<-chan struct{}, bool) {
+			if wait := interval - time.Since(last); wait > 0 {
+				timer := time.NewTimer(wait)
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+				case <-ctx.Stopping():
+					return nil, false
+				}
+				chs = inputs()
+			}
+			last = time.Now()
+			return chs, true
+		},
+		func() (T, bool) {
+			value, _ := source.Get()
+			return value, true
+		},
+		changed(source))
+}
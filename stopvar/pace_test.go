@@ -0,0 +1,119 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package stopvar
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/field-eng-powertools/notify"
+	"github.com/cockroachdb/field-eng-powertools/stopper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebounce(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	stop := stopper.WithContext(ctx)
+
+	v := notify.VarOf(0)
+	debounced := Debounce(stop, v, 50*time.Millisecond)
+	found, ch := debounced.Get()
+	r.Zero(found)
+
+	// A burst of updates should not be visible until it has ended.
+	start := time.Now()
+	for i := 1; i <= 10; i++ {
+		v.Set(i)
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		r.Fail("timed out waiting for debounced value")
+	}
+	r.GreaterOrEqual(time.Since(start), 95*time.Millisecond)
+	found, ch = debounced.Get()
+	r.Equal(10, found)
+
+	// No further notifications should arrive.
+	select {
+	case <-ch:
+		r.Fail("unexpected notification")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	stop.Stop(time.Second)
+	r.NoError(stop.Wait())
+}
+
+func TestThrottle(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	stop := stopper.WithContext(ctx)
+
+	const interval = 50 * time.Millisecond
+	v := notify.VarOf(0)
+	throttled := Throttle(stop, v, interval)
+
+	// Record every value that is observed by a listener.
+	var seen []int
+	var lastSeen time.Time
+	var minGap time.Duration
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for value, ch := throttled.Get(); value < 100; {
+			select {
+			case <-ch:
+			case <-stop.Stopping():
+				return
+			}
+			if !lastSeen.IsZero() {
+				if gap := time.Since(lastSeen); minGap == 0 || gap < minGap {
+					minGap = gap
+				}
+			}
+			lastSeen = time.Now()
+			value, ch = throttled.Get()
+			seen = append(seen, value)
+		}
+	}()
+
+	// Update the source continuously for several intervals.
+	for i := 1; i <= 100; i++ {
+		v.Set(i)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		r.Fail("timed out waiting for final value")
+	}
+	// The latest value is always delivered, but intermediate values
+	// are coalesced.
+	r.Equal(100, seen[len(seen)-1])
+	r.Less(len(seen), 50)
+	r.GreaterOrEqual(minGap, interval/2)
+
+	stop.Stop(time.Second)
+	r.NoError(stop.Wait())
+}
@@ -33,7 +33,7 @@ import (
 func DoWhenChanged[T comparable](
 	ctx *stopper.Context,
 	start T,
-	source *notify.Var[T],
+	source notify.Source[T],
 	fn func(ctx *stopper.Context, old, new T) error,
 ) (last T, err error) {
 	last = start
@@ -58,7 +58,7 @@ func DoWhenChanged[T comparable](
 func DoWhenChangedOrInterval[T comparable](
 	ctx *stopper.Context,
 	start T,
-	source *notify.Var[T],
+	source notify.Source[T],
 	period time.Duration,
 	fn func(ctx *stopper.Context, old, new T) error,
 ) (last T, err error) {
@@ -75,11 +75,30 @@ func DoWhenChangedOrInterval[T comparable](
 	}
 }
 
+// Subscribe returns a lossless [notify.Subscription] to the source
+// which will be closed when the context begins to stop.
+func Subscribe[T any](
+	ctx *stopper.Context, source *notify.Var[T], capacity int, overflow notify.Overflow,
+) *notify.Subscription[T] {
+	sub := source.Subscribe(capacity, overflow)
+	if !ctx.Go(func(ctx *stopper.Context) error {
+		select {
+		case <-ctx.Stopping():
+		case <-sub.Done():
+		}
+		sub.Close()
+		return nil
+	}) {
+		sub.Close()
+	}
+	return sub
+}
+
 // WaitForChange is a utility function that waits for the source to
 // change to another value. If the context is stopped, the most recent
 // value will be returned.
 func WaitForChange[T comparable](
-	ctx *stopper.Context, current T, source *notify.Var[T],
+	ctx *stopper.Context, current T, source notify.Source[T],
 ) (next T, changed <-chan struct{}) {
 	for {
 		next, changed = source.Get()
@@ -99,7 +118,7 @@ func WaitForChange[T comparable](
 // source to change to another value or for the given duration to
 // elapse.
 func WaitForChangeOrDuration[T comparable](
-	ctx *stopper.Context, current T, source *notify.Var[T], d time.Duration,
+	ctx *stopper.Context, current T, source notify.Source[T], d time.Duration,
 ) (next T, changed <-chan struct{}) {
 	timer := time.NewTimer(d)
 	defer timer.Stop()
@@ -121,7 +140,7 @@ func WaitForChangeOrDuration[T comparable](
 
 // WaitForValue is a utility function that waits until the source emits
 // the requested value. This is primarily intended for testing.
-func WaitForValue[T comparable](ctx *stopper.Context, expected T, source *notify.Var[T]) error {
+func WaitForValue[T comparable](ctx *stopper.Context, expected T, source notify.Source[T]) error {
 	for {
 		found, changed := source.Get()
 		if found == expected {
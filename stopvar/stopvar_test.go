@@ -111,6 +111,32 @@ func TestDoWhenChangedOrInterval(t *testing.T) {
 	r.True(called.Load())
 }
 
+func TestSubscribe(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var v notify.Var[int]
+	stop := stopper.WithContext(ctx)
+	sub := Subscribe(stop, &v, 8, notify.Block)
+
+	v.Set(1)
+	v.Set(2)
+	r.Equal(1, <-sub.C())
+	r.Equal(2, <-sub.C())
+
+	// Stopping the context closes the subscription.
+	stop.Stop(time.Minute)
+	r.NoError(stop.Wait())
+	_, open := <-sub.C()
+	r.False(open)
+
+	// Already-stopped contexts produce closed subscriptions.
+	sub = Subscribe(stop, &v, 8, notify.Block)
+	_, open = <-sub.C()
+	r.False(open)
+}
+
 func TestWaitForValue(t *testing.T) {
 	r := require.New(t)
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
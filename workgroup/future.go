@@ -0,0 +1,150 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package workgroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrCanceled is returned from [Future.Await] if the Future was
+// canceled before its callback started.
+var ErrCanceled = errors.New("task canceled before it started")
+
+const (
+	futurePending int32 = iota
+	futureRunning
+	futureCanceled
+)
+
+// A Future holds the eventual outcome of a callback passed to
+// [Submit] or [SubmitWait].
+type Future[T any] struct {
+	done  chan struct{} // Closed once err and value are set.
+	err   error
+	gctx  context.Context // The Group's context.
+	state atomic.Int32
+	value T
+}
+
+// AwaitAll waits for all the futures to complete. The returned slice
+// contains the value of each Future in the same order as the
+// arguments. Any errors are joined together, annotated with the index
+// of the Future that produced them.
+func AwaitAll[T any](ctx context.Context, futures ...*Future[T]) ([]T, error) {
+	ret := make([]T, len(futures))
+	var errs []error
+	for i, f := range futures {
+		value, err := f.Await(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ret, err
+			}
+			errs = append(errs, fmt.Errorf("future %d: %w", i, err))
+			continue
+		}
+		ret[i] = value
+	}
+	return ret, errors.Join(errs...)
+}
+
+// Submit executes the callback in a worker goroutine and returns a
+// Future that will hold its outcome. As with [Group.Go], an error will
+// be returned if the callback cannot be queued.
+func Submit[T any](g *Group, fn func(ctx context.Context) (T, error)) (*Future[T], error) {
+	f, it := newFuture(g, fn)
+	if err := g.submit(it); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SubmitWait is like [Submit], but will block as described in
+// [Group.GoWait].
+func SubmitWait[T any](
+	ctx context.Context, g *Group, fn func(ctx context.Context) (T, error),
+) (*Future[T], error) {
+	f, it := newFuture(g, fn)
+	if err := g.submitWait(ctx, it); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Await blocks until the callback has completed and returns its
+// outcome. If the Group's context is canceled before the callback has
+// started, or if the callback is discarded by [Group.Drain],
+// [ErrCanceled] will be returned.
+func (f *Future[T]) Await(ctx context.Context) (T, error) {
+	groupDone := f.gctx.Done()
+	for {
+		select {
+		case <-f.done:
+			return f.value, f.err
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-groupDone:
+			// A queued callback won't be executed once the Group has
+			// stopped, but one that is running should return soon.
+			f.cancel(context.Cause(f.gctx))
+			groupDone = nil
+		}
+	}
+}
+
+// Cancel prevents the callback from being executed if it has not yet
+// started. It returns true if the callback was canceled.
+func (f *Future[T]) Cancel() bool {
+	return f.cancel(nil)
+}
+
+// Done returns a channel that is closed once the outcome of the
+// Future is available.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// cancel marks the Future as canceled if the callback has not
+// started. The cause, if any, is joined with ErrCanceled.
+func (f *Future[T]) cancel(cause error) bool {
+	if !f.state.CompareAndSwap(futurePending, futureCanceled) {
+		return false
+	}
+	f.err = ErrCanceled
+	if cause != nil {
+		f.err = fmt.Errorf("%w: %w", ErrCanceled, cause)
+	}
+	close(f.done)
+	return true
+}
+
+// newFuture returns a Future and the work item which will complete it.
+func newFuture[T any](g *Group, fn func(ctx context.Context) (T, error)) (*Future[T], item) {
+	f := &Future[T]{done: make(chan struct{}), gctx: g.ctx}
+	it := g.newItem(0, func(ctx context.Context) {
+		if !f.state.CompareAndSwap(futurePending, futureRunning) {
+			return
+		}
+		defer close(f.done)
+		f.value, f.err = fn(ctx)
+	})
+	it.abandon = func(err error) { f.cancel(err) }
+	return f, it
+}
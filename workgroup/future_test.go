@@ -0,0 +1,118 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package workgroup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuture(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	block := make(chan struct{})
+	wg := WithSize(ctx, 1, 10)
+
+	// Occupy the single worker.
+	blocked, err := Submit(wg, func(context.Context) (int, error) {
+		<-block
+		return 1, nil
+	})
+	r.NoError(err)
+
+	boom := errors.New("boom")
+	failed, err := SubmitWait(ctx, wg, func(context.Context) (int, error) { return 0, boom })
+	r.NoError(err)
+	canceled, err := Submit(wg, func(context.Context) (int, error) {
+		r.Fail("should not execute")
+		return 0, nil
+	})
+	r.NoError(err)
+	r.True(canceled.Cancel())
+	r.False(canceled.Cancel())
+
+	// Await can be interrupted.
+	short, cancelShort := context.WithTimeout(ctx, time.Millisecond)
+	defer cancelShort()
+	_, err = blocked.Await(short)
+	r.ErrorIs(err, context.DeadlineExceeded)
+
+	close(block)
+	value, err := blocked.Await(ctx)
+	r.NoError(err)
+	r.Equal(1, value)
+	r.False(blocked.Cancel())
+	<-failed.Done()
+	_, err = failed.Await(ctx)
+	r.ErrorIs(err, boom)
+	_, err = canceled.Await(ctx)
+	r.ErrorIs(err, ErrCanceled)
+
+	// Collect a batch of results.
+	futures := make([]*Future[int], 10)
+	for i := range futures {
+		futures[i], err = SubmitWait(ctx, wg, func(context.Context) (int, error) {
+			if i%3 == 0 {
+				return 0, boom
+			}
+			return i, nil
+		})
+		r.NoError(err)
+	}
+	values, err := AwaitAll(ctx, futures...)
+	r.ErrorIs(err, boom)
+	r.ErrorContains(err, "future 3: boom")
+	r.Equal([]int{0, 1, 2, 0, 4, 5, 0, 7, 8, 0}, values)
+
+	values, err = AwaitAll(ctx, blocked)
+	r.NoError(err)
+	r.Equal([]int{1}, values)
+}
+
+func TestFutureGroupCanceled(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wg := WithSize(ctx, 1, 1)
+	running, err := Submit(wg, func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	r.NoError(err)
+	queued, err := Submit(wg, func(context.Context) (int, error) { return 1, nil })
+	r.NoError(err)
+
+	// Queued work is abandoned once the Group is canceled.
+	cancel()
+	_, err = queued.Await(context.Background())
+	if err != nil {
+		r.ErrorIs(err, ErrCanceled)
+		r.ErrorIs(err, context.Canceled)
+	}
+	_, err = running.Await(context.Background())
+	r.ErrorIs(err, context.Canceled)
+
+	_, err = Submit(wg, func(context.Context) (int, error) { return 0, nil })
+	r.ErrorIs(err, context.Canceled)
+}
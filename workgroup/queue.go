@@ -0,0 +1,93 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package workgroup
+
+// An item is an element of the work queue.
+type item struct {
+	// If non-nil, will be called if the item is discarded by
+	// Group.Drain.
+	abandon func(err error)
+	fn      callback
+	// Items with a lower rank are executed first. The rank is derived
+	// from the time at which the item was submitted, adjusted by its
+	// priority.
+	rank int64
+	seq  uint64 // Ensures FIFO behavior for items of equal rank.
+}
+
+// A queue is a priority queue of items, ordered by rank. It is a
+// binary heap, which is maintained without the use of [container/heap]
+// to avoid boxing each item in an interface value.
+type queue []item
+
+// less returns true if the item at i should be executed before the
+// item at j.
+func (q queue) less(i, j int) bool {
+	if q[i].rank != q[j].rank {
+		return q[i].rank < q[j].rank
+	}
+	return q[i].seq < q[j].seq
+}
+
+// push adds an item to the queue.
+func (q *queue) push(it item) {
+	*q = append(*q, it)
+	q.up(len(*q) - 1)
+}
+
+// pop removes and returns the first item in the queue. The queue must
+// not be empty.
+func (q *queue) pop() item {
+	old := *q
+	n := len(old) - 1
+	old[0], old[n] = old[n], old[0]
+	ret := old[n]
+	old[n] = item{}
+	*q = old[:n]
+	q.down(0)
+	return ret
+}
+
+// up moves the item at i towards the root of the heap.
+func (q queue) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !q.less(i, parent) {
+			return
+		}
+		q[i], q[parent] = q[parent], q[i]
+		i = parent
+	}
+}
+
+// down moves the item at i away from the root of the heap.
+func (q queue) down(i int) {
+	for {
+		child := 2*i + 1
+		if child >= len(q) {
+			return
+		}
+		if right := child + 1; right < len(q) && q.less(right, child) {
+			child = right
+		}
+		if !q.less(child, i) {
+			return
+		}
+		q[i], q[child] = q[child], q[i]
+		i = child
+	}
+}
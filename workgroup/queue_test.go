@@ -0,0 +1,57 @@
+// Copyright 2024 The Cockroach Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package workgroup
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	r := require.New(t)
+
+	var q queue
+	for i, rank := range []int64{3, 1, 2, 1, 0} {
+		q.push(item{rank: rank, seq: uint64(i)})
+	}
+	r.Len(q, 5)
+
+	var seqs []uint64
+	for len(q) > 0 {
+		seqs = append(seqs, q.pop().seq)
+	}
+	// Ordered by rank, then by sequence.
+	r.Equal([]uint64{4, 1, 3, 2, 0}, seqs)
+
+	// Interleave pushes and pops with random ranks. Items remaining
+	// in the queue are popped in order.
+	for i := 0; i < 1000; i++ {
+		q.push(item{rank: rand.Int63n(100), seq: uint64(i)})
+		if i%3 == 0 {
+			q.pop()
+		}
+	}
+	r.Len(q, 666)
+	prev := q.pop()
+	for len(q) > 0 {
+		next := q.pop()
+		r.True(prev.rank < next.rank || (prev.rank == next.rank && prev.seq < next.seq))
+		prev = next
+	}
+}
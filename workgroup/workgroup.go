@@ -18,93 +18,475 @@
 package workgroup
 
 import (
+	"container/list"
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"sync"
 	"time"
+
+	"github.com/cockroachdb/field-eng-powertools/notify"
+	"github.com/cockroachdb/field-eng-powertools/stopper"
 )
 
 const idleNanos = int64(time.Second)
 
+// DefaultAgingStep is the default value for the [AgingStep] option.
+const DefaultAgingStep = 100 * time.Millisecond
+
+// ErrClosed is returned when work is submitted to a Group that has
+// been closed.
+var ErrClosed = errors.New("workgroup is closed")
+
 type callback func(context.Context)
 
 // Group is a basic concurrency-control mechanism that has a
 // bounded pool of worker goroutines executing callbacks from a
-// queue. Unlike an [errgroup.Group], this types does not allow awaiting
-// on outcomes of callbacks.
+// queue. Unlike an [errgroup.Group], the outcomes of callbacks passed
+// to [Group.Go] are not tracked. Use [Submit] to receive a [Future]
+// that holds the outcome of a callback.
+//
+// If the Group is constructed with a [stopper.Context] and the
+// [DrainOnStop] option, the Group will be drained once the stopper
+// begins to stop. That is, no new work will be accepted, but work
+// which has already been queued will be executed until the stopper's
+// grace period has expired.
 //
 // A Group is safe to call from multiple goroutines. A Group should not
 // be copied once created.
 type Group struct {
-	ctx        context.Context
-	handoff    chan callback // Synchronous channel for immediate dispatch.
-	maxWorkers int
-	queue      chan callback // Buffered channel for work backlog.
+	agingStep time.Duration
+	closing   chan struct{} // Closed by Close to release idle workers.
+	ctx       context.Context
+	drained   chan struct{} // Closed once closed and all work has finished.
+	epoch     time.Time     // Item ranks are relative to this time.
+	handoff   chan callback // Synchronous channel for immediate dispatch.
+	ready     chan struct{} // Holds a token if the queue is non-empty.
 
 	mu struct {
 		sync.Mutex
-		numWorkers int
+		active        int // The number of executing callbacks.
+		closed        bool
+		maxQueueDepth int
+		maxWorkers    int
+		numWorkers    int
+		queue         queue     // Work backlog.
+		seq           uint64    // Assigns sequence numbers to items.
+		waiters       list.List // FIFO of *waiter blocked in GoWait.
+	}
+}
+
+// A waiter represents a caller of GoWait that is blocked until there
+// is room in the queue.
+type waiter struct {
+	accepted chan struct{} // Closed once item has been dequeued or rejected.
+	err      error         // Set if the Group was closed.
+	item     item
+}
+
+// An Option configures a Group constructed by [WithSize].
+type Option func(o *options)
+
+type options struct {
+	agingStep     time.Duration
+	drainOnStop   bool
+	maxQueueDepth notify.Source[int]
+	maxWorkers    notify.Source[int]
+}
+
+// AgingStep controls how quickly queued work that was submitted with a
+// lower priority catches up to work with a higher priority. Work that
+// has waited in the queue for longer than the step is treated as
+// though its priority were one greater. That is, work with priority 0
+// will be executed before newly-submitted work with priority 1 once it
+// has been queued for longer than one step. This prevents
+// low-priority work from being starved. If the step is zero,
+// [DefaultAgingStep] will be used.
+func AgingStep(step time.Duration) Option {
+	return func(o *options) {
+		o.agingStep = step
+	}
+}
+
+// DrainOnStop causes a Group constructed from a [stopper.Context] to be
+// drained by a task within the stopper once the stopper begins to stop.
+// The task is labeled "workgroup drain" and will report a [DrainError]
+// if work was abandoned when the stopper's grace period expired. The
+// task is tracked by the stopper until the Group has been drained, so
+// the Group should be closed once it is no longer needed. This option
+// has no effect if the Group is not constructed from a stopper.
+func DrainOnStop() Option {
+	return func(o *options) {
+		o.drainOnStop = true
+	}
+}
+
+// MaxQueueDepthFrom causes the maximum queue depth of the Group to
+// track the value of the source. The value passed to [WithSize] is
+// ignored. See [Group.SetMaxQueueDepth]. The source is followed until
+// the Group has been drained or its context has been canceled.
+func MaxQueueDepthFrom(source notify.Source[int]) Option {
+	return func(o *options) {
+		o.maxQueueDepth = source
+	}
+}
+
+// MaxWorkersFrom causes the maximum number of workers in the Group to
+// track the value of the source. The value passed to [WithSize] is
+// ignored. See [Group.SetMaxWorkers]. The source is followed until the
+// Group has been drained or its context has been canceled.
+func MaxWorkersFrom(source notify.Source[int]) Option {
+	return func(o *options) {
+		o.maxWorkers = source
 	}
 }
 
 // WithSize returns a [Group] that will execute with up to the
 // requested number of goroutines and queue up to the requested number
 // of work elements.
-func WithSize(ctx context.Context, maxWorkers int, maxQueueDepth int) *Group {
-	return &Group{
-		ctx:        ctx,
-		handoff:    make(chan callback),
-		maxWorkers: maxWorkers,
-		queue:      make(chan callback, maxQueueDepth),
+func WithSize(ctx context.Context, maxWorkers int, maxQueueDepth int, opts ...Option) *Group {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.agingStep <= 0 {
+		o.agingStep = DefaultAgingStep
+	}
+
+	g := &Group{
+		agingStep: o.agingStep,
+		closing:   make(chan struct{}),
+		ctx:       ctx,
+		drained:   make(chan struct{}),
+		epoch:     time.Now(),
+		handoff:   make(chan callback),
+		ready:     make(chan struct{}, 1),
+	}
+	g.mu.maxQueueDepth = maxQueueDepth
+	g.mu.maxWorkers = maxWorkers
+	if o.maxQueueDepth != nil {
+		g.follow(o.maxQueueDepth, g.SetMaxQueueDepth)
+	}
+	if o.maxWorkers != nil {
+		g.follow(o.maxWorkers, g.SetMaxWorkers)
+	}
+
+	if s := stopper.From(ctx); o.drainOnStop && s != stopper.Background() {
+		if !s.Go(func(s *stopper.Context) error {
+			select {
+			case <-s.Stopping():
+				return g.Drain(s)
+			case <-g.drained:
+				return nil
+			}
+		}, stopper.TaskLabel("workgroup drain")) {
+			// The stopper is already stopping.
+			g.Close()
+		}
 	}
+	return g
 }
 
-// Go executes the callback in a worker goroutine. If all workers have
-// been created and the queue is full, an error will be returned.
-func (g *Group) Go(fn func(ctx context.Context)) error {
-	if err := g.ctx.Err(); err != nil {
-		return err
+// Close prevents any new work from being submitted to the Group.
+// Callers that are blocked in [Group.GoWait] will receive [ErrClosed].
+// Work that has already been queued will still be executed. The
+// channel returned from [Group.Done] will be closed once all work has
+// finished. This method is idempotent.
+func (g *Group) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.mu.closed {
+		return
 	}
+	g.mu.closed = true
+	close(g.closing)
 
-	// Synchronous handoff to a waiting worker.
-	select {
-	case g.handoff <- fn:
-		return nil
-	default:
+	for elt := g.mu.waiters.Front(); elt != nil; elt = elt.Next() {
+		w := elt.Value.(*waiter)
+		w.err = ErrClosed
+		close(w.accepted)
 	}
+	g.mu.waiters.Init()
+	g.maybeDrainedLocked()
+}
 
-	// Warm-up case where we start a worker to handle the work unit.
-	if g.maybeStart(fn) {
+// Done returns a channel that will be closed once the Group has been
+// closed and all work has finished.
+func (g *Group) Done() <-chan struct{} {
+	return g.drained
+}
+
+// A DrainError is returned from [Group.Drain] if queued work was
+// discarded or if callbacks were still executing when the context
+// passed to Drain was canceled.
+type DrainError struct {
+	Abandoned int   // The number of queued callbacks which were discarded.
+	Cause     error // The reason that the drain did not complete.
+	Running   int   // The number of callbacks that were still executing.
+}
+
+func (e *DrainError) Error() string {
+	return fmt.Sprintf("workgroup drain interrupted: %d abandoned, %d running: %v",
+		e.Abandoned, e.Running, e.Cause)
+}
+
+// Unwrap returns the cause.
+func (e *DrainError) Unwrap() error {
+	return e.Cause
+}
+
+// Drain closes the Group and waits for all queued work to be executed.
+// If the context is canceled or the Group's context is canceled before
+// the Group has drained, any work remaining in the queue is discarded
+// and a [DrainError] describing the discarded and running work is
+// returned. Callers may wait on [Group.Done] to determine when the
+// running callbacks have finished.
+func (g *Group) Drain(ctx context.Context) error {
+	g.Close()
+
+	var cause error
+	select {
+	case <-g.drained:
 		return nil
+	case <-ctx.Done():
+		cause = context.Cause(ctx)
+	case <-g.ctx.Done():
+		cause = context.Cause(g.ctx)
 	}
 
-	select {
-	case g.queue <- fn:
-		// This represents an exceedingly unlikely case where all
-		// workers simultaneously selected on their idle channel and
-		// exited instead of consuming a work unit.
-		g.maybeStart(nil)
+	g.mu.Lock()
+	abandoned := g.mu.queue
+	g.mu.queue = nil
+	running := g.mu.active
+	g.maybeDrainedLocked()
+	g.mu.Unlock()
+
+	if len(abandoned) == 0 && running == 0 {
 		return nil
-	default:
-		return fmt.Errorf("queue depth %d exceeded", cap(g.queue))
 	}
+	err := &DrainError{Abandoned: len(abandoned), Cause: cause, Running: running}
+	for _, it := range abandoned {
+		if it.abandon != nil {
+			it.abandon(err)
+		}
+	}
+	return err
+}
+
+// Go executes the callback in a worker goroutine. If all workers have
+// been created and the queue is full, an error will be returned. This
+// is equivalent to calling [Group.GoPriority] with a priority of zero.
+func (g *Group) Go(fn func(ctx context.Context)) error {
+	return g.submit(g.newItem(0, fn))
+}
+
+// GoPriority is like [Group.Go], but queued callbacks with a higher
+// priority will be executed before those with a lower priority,
+// subject to the [AgingStep] option. Callbacks of equal priority are
+// executed in the order in which they were submitted. Priority does
+// not affect callbacks that are handed off directly to an idle worker.
+func (g *Group) GoPriority(priority int, fn func(ctx context.Context)) error {
+	return g.submit(g.newItem(priority, fn))
+}
+
+// GoWait executes the callback in a worker goroutine. If all workers
+// have been created and the queue is full, the caller will be blocked
+// until there is room in the queue or the context has been canceled.
+// Blocked callers are admitted in the order in which they called
+// GoWait.
+func (g *Group) GoWait(ctx context.Context, fn func(ctx context.Context)) error {
+	return g.submitWait(ctx, g.newItem(0, fn))
+}
+
+// GoWaitPriority is like [Group.GoWait], but with the queueing behavior
+// of [Group.GoPriority]. Blocked callers are admitted to the queue in
+// FIFO order, regardless of priority.
+func (g *Group) GoWaitPriority(
+	ctx context.Context, priority int, fn func(ctx context.Context),
+) error {
+	return g.submitWait(ctx, g.newItem(priority, fn))
 }
 
 // Len returns the number of queued work items.
 func (g *Group) Len() int {
-	return len(g.queue)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.mu.queue)
+}
+
+// MaxQueueDepth returns the current maximum queue depth.
+func (g *Group) MaxQueueDepth() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.mu.maxQueueDepth
+}
+
+// MaxWorkers returns the current maximum number of workers.
+func (g *Group) MaxWorkers() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.mu.maxWorkers
+}
+
+// SetMaxQueueDepth changes the maximum queue depth. If the depth is
+// increased, callers blocked in [Group.GoWait] will be admitted to the
+// queue. If the depth is decreased, work that has already been queued
+// will be retained, but new work will not be accepted until the queue
+// has shrunk below the new depth.
+func (g *Group) SetMaxQueueDepth(depth int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.mu.maxQueueDepth = max(depth, 0)
+	if g.admitLocked(g.mu.maxQueueDepth) {
+		g.signal()
+	}
+}
+
+// SetMaxWorkers changes the maximum number of workers. If the number is
+// increased, additional workers will be started immediately to process
+// any queued work. If the number is decreased, excess workers will exit
+// once they have finished their current callback.
+func (g *Group) SetMaxWorkers(workers int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.mu.maxWorkers = max(workers, 0)
+	if g.ctx.Err() != nil {
+		return
+	}
+	for pending := len(g.mu.queue) + g.mu.waiters.Len(); pending > 0; pending-- {
+		if !g.maybeStartLocked(nil) {
+			break
+		}
+	}
+}
+
+// follow calls the setter with each new value of the source until the
+// Group has stopped.
+func (g *Group) follow(source notify.Source[int], set func(int)) {
+	value, changed := source.Get()
+	set(value)
+	go func() {
+		for {
+			select {
+			case <-changed:
+				value, changed = source.Get()
+				set(value)
+			case <-g.ctx.Done():
+				return
+			case <-g.drained:
+				return
+			}
+		}
+	}()
 }
 
-// maybeStart will return true if started a worker goroutine that is
-// guaranteed to execute the callback.
-func (g *Group) maybeStart(fn callback) bool {
+// newItem computes the rank of a work item.
+func (g *Group) newItem(priority int, fn callback) item {
+	rank := int64(time.Since(g.epoch)) - int64(priority)*int64(g.agingStep)
+	return item{fn: fn, rank: rank}
+}
+
+// next is called by workers to retrieve the next work item, returning
+// nil if there is none. The finished argument indicates that the
+// worker has completed a callback. If there are blocked callers of
+// GoWait, the oldest will be admitted to the queue if there is room. If
+// the worker is in
+// excess of the maximum number of workers, retire will be true and the
+// worker should exit.
+func (g *Group) next(finished bool) (_ callback, retire bool) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	if g.mu.numWorkers >= g.maxWorkers {
+	if finished {
+		g.mu.active--
+	}
+	if g.mu.numWorkers > g.mu.maxWorkers {
+		g.mu.numWorkers--
+		// Pass along any wakeup that this worker may have consumed.
+		if g.hasWorkLocked() {
+			g.signal()
+		}
+		g.maybeDrainedLocked()
+		return nil, true
+	}
+
+	// Admit blocked callers before choosing the next item, since they
+	// may have a higher priority than what's in the queue. If the
+	// maximum depth is zero, a blocked caller is handed directly to
+	// this worker.
+	g.admitLocked(max(g.mu.maxQueueDepth, 1))
+
+	var ret callback
+	if len(g.mu.queue) > 0 {
+		ret = g.mu.queue.pop().fn
+		// Fill the slot that was just vacated.
+		g.admitLocked(g.mu.maxQueueDepth)
+	}
+
+	if ret == nil {
+		g.maybeDrainedLocked()
+		return nil, false
+	}
+	g.mu.active++
+	// Wake another worker if there's more work to do.
+	if len(g.mu.queue) > 0 {
+		g.signal()
+	}
+	return ret, false
+}
+
+// admitLocked moves blocked callers of GoWait into the queue, in FIFO
+// order, until the queue holds the given number of items. It returns
+// true if any callers were admitted.
+func (g *Group) admitLocked(depth int) bool {
+	admitted := false
+	for len(g.mu.queue) < depth {
+		front := g.mu.waiters.Front()
+		if front == nil {
+			break
+		}
+		w := g.mu.waiters.Remove(front).(*waiter)
+		close(w.accepted)
+		g.pushLocked(w.item)
+		admitted = true
+	}
+	return admitted
+}
+
+// enqueueLocked adds the item to the queue and wakes a worker.
+func (g *Group) enqueueLocked(it item) {
+	g.pushLocked(it)
+	g.signal()
+}
+
+// hasWorkLocked returns true if there are queued or blocked callbacks.
+func (g *Group) hasWorkLocked() bool {
+	return len(g.mu.queue) > 0 || g.mu.waiters.Len() > 0
+}
+
+// maybeDrainedLocked closes the drained channel if the Group has been
+// closed and there is no further work to perform.
+func (g *Group) maybeDrainedLocked() {
+	if !g.mu.closed || g.mu.active > 0 || g.hasWorkLocked() {
+		return
+	}
+	select {
+	case <-g.drained:
+	default:
+		close(g.drained)
+	}
+}
+
+// maybeStartLocked will return true if started a worker goroutine that
+// is guaranteed to execute the callback.
+func (g *Group) maybeStartLocked(fn callback) bool {
+	if g.mu.numWorkers >= g.mu.maxWorkers {
 		return false
 	}
 	g.mu.numWorkers++
+	if fn != nil {
+		g.mu.active++
+	}
 
 	// If we start a worker, we want to know that the initiating
 	// callback will be executed by the worker. This lends
@@ -114,43 +496,167 @@ func (g *Group) maybeStart(fn callback) bool {
 	return true
 }
 
-func (g *Group) worker(ctx context.Context, initial callback) {
+// pushLocked adds the item to the queue.
+func (g *Group) pushLocked(it item) {
+	g.mu.seq++
+	it.seq = g.mu.seq
+	g.mu.queue.push(it)
+}
+
+// signal ensures that the ready channel holds a token.
+func (g *Group) signal() {
+	select {
+	case g.ready <- struct{}{}:
+	default:
+	}
+}
+
+// submit implements Go.
+func (g *Group) submit(it item) error {
+	if err := g.ctx.Err(); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if ok, err := g.tryGoLocked(it); ok || err != nil {
+		return err
+	}
+	return fmt.Errorf("queue depth %d exceeded", g.mu.maxQueueDepth)
+}
+
+// submitWait implements GoWait.
+func (g *Group) submitWait(ctx context.Context, it item) error {
+	if err := g.ctx.Err(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	if ok, err := g.tryGoLocked(it); ok || err != nil {
+		g.mu.Unlock()
+		return err
+	}
+	w := &waiter{accepted: make(chan struct{}), item: it}
+	elt := g.mu.waiters.PushBack(w)
+	// Wake an idle worker, if any, or start one if all workers have
+	// exited.
+	g.signal()
+	if g.mu.numWorkers == 0 {
+		g.maybeStartLocked(nil)
+	}
+	g.mu.Unlock()
+
+	var err error
+	select {
+	case <-w.accepted:
+		return w.err
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-g.ctx.Done():
+		err = g.ctx.Err()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-w.accepted:
+		// The callback was accepted before we could withdraw it.
+		return w.err
+	default:
+		g.mu.waiters.Remove(elt)
+		return err
+	}
+}
+
+// tryGoLocked attempts to execute the callback without blocking.
+func (g *Group) tryGoLocked(it item) (bool, error) {
+	if g.mu.closed {
+		return false, ErrClosed
+	}
+
+	// Synchronous handoff to a waiting worker, unless the number of
+	// workers is being reduced.
+	if g.mu.active < g.mu.maxWorkers {
+		select {
+		case g.handoff <- it.fn:
+			g.mu.active++
+			return true, nil
+		default:
+		}
+	}
+
+	// Warm-up case where we start a worker to handle the work unit.
+	if g.maybeStartLocked(it.fn) {
+		return true, nil
+	}
+
+	// Callers blocked in GoWait have priority.
+	if g.mu.waiters.Len() > 0 || len(g.mu.queue) >= g.mu.maxQueueDepth {
+		return false, nil
+	}
+	g.enqueueLocked(it)
+	return true, nil
+}
+
+func (g *Group) worker(ctx context.Context, fn callback) {
+	var retired bool
 	defer func() {
+		if retired {
+			// Accounting was performed by next.
+			return
+		}
 		g.mu.Lock()
+		defer g.mu.Unlock()
 		g.mu.numWorkers--
-		g.mu.Unlock()
+		if fn != nil {
+			// The callback did not return normally.
+			g.mu.active--
+		}
 
 		// When a worker exits, we want to ensure that a replacement
 		// worker will be available to pick up any leftover work that
 		// this worker could have picked up.
-		if len(g.queue) > 0 && ctx.Err() == nil {
-			g.maybeStart(nil)
+		if g.hasWorkLocked() && ctx.Err() == nil {
+			g.maybeStartLocked(nil)
 		}
+		g.maybeDrainedLocked()
 	}()
 
-	if initial != nil {
-		initial(ctx)
-		initial = nil
-	}
-
 	timer := time.NewTimer(0)
 	defer timer.Stop()
 
 	for {
+		if fn != nil {
+			fn(ctx)
+		}
+		// Execute the next work unit out of the backlog.
+		if fn, retired = g.next(fn != nil); fn != nil {
+			continue
+		} else if retired {
+			return
+		}
+
 		// Reset timer and smear timeout behaviors.
 		if !timer.Stop() {
-			<-timer.C
+			select {
+			case <-timer.C:
+			default:
+			}
 		}
 		timer.Reset(time.Duration(idleNanos + rand.Int63n(idleNanos)))
 
 		select {
-		case next := <-g.handoff:
+		case fn = <-g.handoff:
 			// Execute the next work unit from a synchronous handoff.
-			next(ctx)
 
-		case next := <-g.queue:
-			// Execute the next work unit out of the backlog.
-			next(ctx)
+		case <-g.ready:
+			// Loop around to dequeue.
+
+		case <-g.closing:
+			// No new work will arrive.
+			return
 
 		case <-timer.C:
 			// If we've been idle for a while, shed goroutines.
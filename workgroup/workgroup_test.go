@@ -18,12 +18,15 @@ package workgroup
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/cockroachdb/field-eng-powertools/notify"
+	"github.com/cockroachdb/field-eng-powertools/stopper"
 	"github.com/stretchr/testify/require"
 )
 
@@ -133,3 +136,448 @@ func TestWorkGroup(t *testing.T) {
 	cancel()
 	r.ErrorIs(wg.Go(nil), context.Canceled)
 }
+
+func TestGoWait(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	const waiters = 10
+	block := make(chan struct{})
+	wg := WithSize(ctx, 1, 1)
+
+	// Occupy the worker and the queue.
+	r.NoError(wg.GoWait(ctx, func(context.Context) { <-block }))
+	r.NoError(wg.GoWait(ctx, func(context.Context) {}))
+	r.ErrorContains(wg.Go(func(context.Context) {}), "queue depth 1 exceeded")
+
+	// A blocked caller can be canceled.
+	canceled, cancelWait := context.WithTimeout(ctx, time.Millisecond)
+	defer cancelWait()
+	r.ErrorIs(wg.GoWait(canceled, func(context.Context) {}), context.DeadlineExceeded)
+
+	// Start blocked callers, one at a time, to establish an order.
+	var order notify.Var[[]int]
+	errs := make(chan error, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			errs <- wg.GoWait(ctx, func(context.Context) {
+				_, _, _ = order.Update(func(old []int) ([]int, error) {
+					return append(old, i), nil
+				})
+			})
+		}()
+		r.Eventually(func() bool {
+			wg.mu.Lock()
+			defer wg.mu.Unlock()
+			return wg.mu.waiters.Len() == i+1
+		}, 10*time.Second, time.Millisecond)
+	}
+
+	// Blocked callers have priority over non-blocking calls.
+	r.Error(wg.Go(func(context.Context) {}))
+
+	close(block)
+	for i := 0; i < waiters; i++ {
+		r.NoError(<-errs)
+	}
+	r.Eventually(func() bool {
+		found, _ := order.Get()
+		return len(found) == waiters
+	}, 10*time.Second, time.Millisecond)
+	found, _ := order.Get()
+	for i, value := range found {
+		r.Equal(i, value)
+	}
+}
+
+func TestGoWaitNoQueue(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	const count = 100
+	wg := WithSize(ctx, 2, 0)
+	var calls notify.Var[int]
+	for i := 0; i < count; i++ {
+		r.NoError(wg.GoWait(ctx, func(context.Context) {
+			time.Sleep(time.Millisecond)
+			_, _, _ = calls.Update(func(old int) (int, error) { return old + 1, nil })
+		}))
+	}
+	r.Eventually(func() bool {
+		found, _ := calls.Get()
+		return found == count
+	}, 10*time.Second, time.Millisecond)
+
+	// Verify cancellation of the Group.
+	cancel()
+	r.ErrorIs(wg.GoWait(context.Background(), nil), context.Canceled)
+}
+
+func TestClose(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	block := make(chan struct{})
+	var calls notify.Var[int]
+	increment := func(context.Context) {
+		<-block
+		_, _, _ = calls.Update(func(old int) (int, error) { return old + 1, nil })
+	}
+
+	wg := WithSize(ctx, 2, 2)
+	for i := 0; i < 4; i++ {
+		r.NoError(wg.Go(increment))
+	}
+	blocked := make(chan error)
+	go func() { blocked <- wg.GoWait(ctx, increment) }()
+	r.Eventually(func() bool {
+		wg.mu.Lock()
+		defer wg.mu.Unlock()
+		return wg.mu.waiters.Len() == 1
+	}, 10*time.Second, time.Millisecond)
+
+	// Closing rejects new and blocked work.
+	wg.Close()
+	wg.Close()
+	r.ErrorIs(<-blocked, ErrClosed)
+	r.ErrorIs(wg.Go(increment), ErrClosed)
+	r.ErrorIs(wg.GoWait(ctx, increment), ErrClosed)
+	select {
+	case <-wg.Done():
+		r.Fail("should not be done")
+	default:
+	}
+
+	// Queued work is still executed.
+	close(block)
+	select {
+	case <-wg.Done():
+	case <-ctx.Done():
+		r.NoError(ctx.Err())
+	}
+	count, _ := calls.Get()
+	r.Equal(4, count)
+	r.NoError(wg.Drain(ctx))
+}
+
+func TestDrain(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	block := make(chan struct{})
+	wg := WithSize(ctx, 1, 3)
+	r.NoError(wg.Go(func(context.Context) { <-block }))
+	futures := make([]*Future[int], 3)
+	for i := range futures {
+		var err error
+		futures[i], err = Submit(wg, func(context.Context) (int, error) { return i, nil })
+		r.NoError(err)
+	}
+
+	// The deadline expires before the queue has drained.
+	short, cancelShort := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancelShort()
+	err := wg.Drain(short)
+	var drainErr *DrainError
+	r.ErrorAs(err, &drainErr)
+	r.ErrorIs(err, context.DeadlineExceeded)
+	r.Equal(3, drainErr.Abandoned)
+	r.Equal(1, drainErr.Running)
+	for _, f := range futures {
+		_, err := f.Await(ctx)
+		r.ErrorIs(err, ErrCanceled)
+		r.ErrorAs(err, &drainErr)
+	}
+
+	// Wait for the running task.
+	close(block)
+	select {
+	case <-wg.Done():
+	case <-ctx.Done():
+		r.NoError(ctx.Err())
+	}
+	r.Zero(wg.Len())
+}
+
+func TestDrainStopper(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Queued work is drained when the stopper begins to stop.
+	stop := stopper.WithContext(ctx)
+	wg := WithSize(stop, 1, 10, DrainOnStop())
+	r.Equal([]string{"workgroup drain"}, stop.Snapshot().Labels())
+	var calls notify.Var[int]
+	for i := 0; i < 10; i++ {
+		r.NoError(wg.Go(func(context.Context) {
+			time.Sleep(time.Millisecond)
+			_, _, _ = calls.Update(func(old int) (int, error) { return old + 1, nil })
+		}))
+	}
+	stop.Stop(time.Minute)
+	r.NoError(stop.Wait())
+	count, _ := calls.Get()
+	r.Equal(10, count)
+	r.ErrorIs(wg.Go(func(context.Context) {}), context.Canceled)
+
+	// Abandoned work is reported once the grace period expires.
+	stop = stopper.WithContext(ctx)
+	wg = WithSize(stop, 1, 10, DrainOnStop())
+	block := make(chan struct{})
+	defer close(block)
+	for i := 0; i < 2; i++ {
+		r.NoError(wg.Go(func(context.Context) { <-block }))
+	}
+	stop.Stop(10 * time.Millisecond)
+	// The drain task's error races with the cancellation of the
+	// stopper once the grace period expires.
+	var drainErr *DrainError
+	r.Eventually(func() bool {
+		return errors.As(stop.Wait(), &drainErr)
+	}, time.Second, time.Millisecond)
+	r.Equal(1, drainErr.Abandoned)
+	r.ErrorIs(drainErr, stopper.ErrGracePeriodExpired)
+
+	// A Group created from a stopped Context is closed.
+	wg = WithSize(stop, 1, 10, DrainOnStop())
+	r.ErrorIs(wg.Go(func(context.Context) {}), context.Canceled)
+	<-wg.Done()
+}
+
+func TestStopperNotPinned(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Groups that do not opt into draining are not tracked by the
+	// stopper and do not start any goroutines until work is submitted.
+	stop := stopper.WithContext(ctx)
+	before := runtime.NumGoroutine()
+	for i := 0; i < 1000; i++ {
+		WithSize(stop, 1, 10)
+	}
+	r.Zero(stop.Len())
+	r.Empty(stop.Snapshot().Labels())
+	r.Less(runtime.NumGoroutine(), before+10)
+
+	// A Group that opts into draining releases the stopper once it has
+	// been closed.
+	wg := WithSize(stop, 1, 10, DrainOnStop())
+	r.Equal(1, stop.Len())
+	wg.Close()
+	<-wg.Done()
+	r.Eventually(func() bool { return stop.Len() == 0 }, time.Second, time.Millisecond)
+
+	stop.Stop(time.Minute)
+	select {
+	case <-stop.Done():
+	case <-ctx.Done():
+		r.Fail("stopper did not stop")
+	}
+	r.NoError(stop.Wait())
+}
+
+func TestResize(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	numWorkers := func(wg *Group) int {
+		wg.mu.Lock()
+		defer wg.mu.Unlock()
+		return wg.mu.numWorkers
+	}
+
+	// Track the maximum number of concurrent callbacks.
+	var running, peak notify.Var[int]
+	release := make(chan struct{})
+	task := func(context.Context) {
+		current, _, _ := running.Update(func(old int) (int, error) { return old + 1, nil })
+		_, _, _ = peak.Update(func(old int) (int, error) { return max(old, current), nil })
+		<-release
+		_, _, _ = running.Update(func(old int) (int, error) { return old - 1, nil })
+	}
+
+	workers := notify.VarOf(1)
+	depth := notify.VarOf(2)
+	wg := WithSize(ctx, 100, 100, MaxWorkersFrom(workers), MaxQueueDepthFrom(depth))
+	r.Equal(1, wg.MaxWorkers())
+	r.Equal(2, wg.MaxQueueDepth())
+
+	r.NoError(wg.Go(task))
+	r.NoError(wg.Go(task))
+	r.NoError(wg.Go(task))
+	r.Error(wg.Go(task))
+	blocked := make(chan error)
+	go func() { blocked <- wg.GoWait(ctx, task) }()
+
+	// Growing the queue admits blocked callers.
+	depth.Set(3)
+	r.NoError(<-blocked)
+	r.Equal(3, wg.Len())
+
+	// Growing the pool starts workers immediately.
+	workers.Set(4)
+	r.Eventually(func() bool {
+		current, _ := running.Get()
+		return current == 4
+	}, 10*time.Second, time.Millisecond)
+	r.Equal(4, numWorkers(wg))
+	r.Zero(wg.Len())
+
+	// Shrinking the pool retires workers as they finish.
+	wg.SetMaxWorkers(2)
+	r.Equal(2, wg.MaxWorkers())
+	close(release)
+	for i := 0; i < 10; i++ {
+		r.NoError(wg.GoWait(ctx, task))
+	}
+	r.Eventually(func() bool {
+		current, _ := running.Get()
+		return current == 0 && wg.Len() == 0
+	}, 10*time.Second, time.Millisecond)
+	r.LessOrEqual(numWorkers(wg), 2)
+
+	// Verify that the smaller pool is respected once settled.
+	_, _, _ = peak.Update(func(int) (int, error) { return 0, nil })
+	for i := 0; i < 20; i++ {
+		r.NoError(wg.GoWait(ctx, func(ctx context.Context) {
+			task(ctx)
+			time.Sleep(time.Millisecond)
+		}))
+	}
+	r.Eventually(func() bool {
+		current, _ := running.Get()
+		return current == 0 && wg.Len() == 0
+	}, 10*time.Second, time.Millisecond)
+	found, _ := peak.Get()
+	r.LessOrEqual(found, 2)
+}
+
+func TestShrinkQueueWithWaiters(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Each callback runs until it receives a step.
+	step := make(chan struct{})
+	task := func(context.Context) { <-step }
+
+	wg := WithSize(ctx, 1, 4)
+	for i := 0; i < 5; i++ {
+		r.NoError(wg.Go(task))
+	}
+	r.Equal(4, wg.Len())
+	wg.SetMaxQueueDepth(1)
+
+	const blocked = 20
+	errs := make(chan error, blocked)
+	for i := 0; i < blocked; i++ {
+		go func() { errs <- wg.GoWait(ctx, task) }()
+	}
+	r.Eventually(func() bool {
+		wg.mu.Lock()
+		defer wg.mu.Unlock()
+		return wg.mu.waiters.Len() == blocked
+	}, 10*time.Second, time.Millisecond)
+
+	// Blocked callers are not admitted until the queue has drained
+	// below the new depth.
+	for i := 0; i < 3; i++ {
+		step <- struct{}{}
+		r.Eventually(func() bool { return wg.Len() == 3-i }, 10*time.Second, time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		step <- struct{}{}
+		r.LessOrEqual(wg.Len(), 1)
+	}
+
+	close(step)
+	for i := 0; i < blocked; i++ {
+		r.NoError(<-errs)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var order notify.Var[[]string]
+	record := func(label string) func(context.Context) {
+		return func(context.Context) {
+			_, _, _ = order.Update(func(old []string) ([]string, error) {
+				return append(old, label), nil
+			})
+		}
+	}
+	await := func(count int) []string {
+		r.Eventually(func() bool {
+			found, _ := order.Get()
+			return len(found) == count
+		}, 10*time.Second, time.Millisecond)
+		ret, _ := order.Swap(nil)
+		return ret
+	}
+
+	const step = 50 * time.Millisecond
+	wg := WithSize(ctx, 1, 10, AgingStep(step))
+
+	// Occupy the worker, so that work is queued.
+	block := make(chan struct{})
+	r.NoError(wg.Go(func(context.Context) { <-block }))
+	r.NoError(wg.GoPriority(-1, record("low")))
+	r.NoError(wg.Go(record("normal-a")))
+	r.NoError(wg.GoPriority(5, record("high-a")))
+	r.NoError(wg.Go(record("normal-b")))
+	r.NoError(wg.GoWaitPriority(ctx, 5, record("high-b")))
+	close(block)
+	r.Equal([]string{"high-a", "high-b", "normal-a", "normal-b", "low"}, await(5))
+
+	// Work that has waited long enough overtakes higher priorities.
+	block = make(chan struct{})
+	r.NoError(wg.GoWait(ctx, func(context.Context) { <-block }))
+	r.Eventually(func() bool {
+		wg.mu.Lock()
+		defer wg.mu.Unlock()
+		return wg.mu.active == 1
+	}, 10*time.Second, time.Millisecond)
+	r.NoError(wg.Go(record("aged")))
+	time.Sleep(3 * step)
+	r.NoError(wg.GoPriority(1, record("urgent")))
+	close(block)
+	r.Equal([]string{"aged", "urgent"}, await(2))
+}
+
+// BenchmarkGo measures the cost of submitting short callbacks from
+// many goroutines, which exercises the handoff to idle workers.
+func BenchmarkGo(b *testing.B) {
+	for _, parallelism := range []int{1, 16} {
+		b.Run(fmt.Sprintf("parallelism=%d", parallelism), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			wg := WithSize(ctx, runtime.GOMAXPROCS(0), 1024)
+
+			var done sync.WaitGroup
+			done.Add(b.N)
+			fn := func(context.Context) { done.Done() }
+
+			b.SetParallelism(parallelism)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					for wg.Go(fn) != nil {
+						runtime.Gosched()
+					}
+				}
+			})
+			done.Wait()
+		})
+	}
+}